@@ -0,0 +1,101 @@
+package autohttp
+
+import (
+	"encoding"
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+const maxBinaryDecoderInputArgs = 4
+
+// An Unmarshaler decodes itself from raw bytes, as implemented by
+// protobuf and other generated message types
+type Unmarshaler interface {
+	Unmarshal(b []byte) error
+}
+
+var (
+	unmarshalerType       = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// BinaryDecoder passes the raw request body to the function argument's
+// Unmarshal or UnmarshalBinary method, which makes it suitable for protobuf
+// style messages. It accepts any content type, so it is best used behind a
+// ContentTypeDecoder
+type BinaryDecoder struct {
+	MaxBytesToRead int64
+}
+
+func NewBinaryDecoder() *BinaryDecoder {
+	return &BinaryDecoder{
+		MaxBytesToRead: DefaultMaxBytesToRead,
+	}
+}
+
+func (bd *BinaryDecoder) ValidateType(fn interface{}) error {
+	ia, err := bd.inputsAtIndices(fn)
+	if err != nil {
+		return err
+	}
+
+	if ia.decodeIdx == uIdx {
+		return nil
+	}
+
+	if !isBinaryDecodable(reflect.ValueOf(fn).Type().In(ia.decodeIdx)) {
+		return errors.New("binary decoder requires an argument implementing Unmarshal([]byte) error or encoding.BinaryUnmarshaler")
+	}
+
+	return nil
+}
+
+func (bd *BinaryDecoder) inputsAtIndices(fn interface{}) (inputArgs, error) {
+	return findInputArgs(fn, maxBinaryDecoderInputArgs, isBodyDecodable)
+}
+
+func isBinaryDecodable(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+
+	return t.Implements(unmarshalerType) || t.Implements(binaryUnmarshalerType)
+}
+
+// Decode returns the reflect values needed to call the fn
+// from the *http.Request
+func (bd *BinaryDecoder) Decode(fn interface{}, r *http.Request) ([]reflect.Value, error) {
+	ia, err := bd.inputsAtIndices(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	callValues := ia.injectedValues(fn, r)
+	if ia.decodeIdx == uIdx {
+		return callValues, nil
+	}
+
+	b, err := readLimitedBody(r, bd.MaxBytesToRead)
+	if err != nil {
+		return nil, err
+	}
+
+	inArg := reflect.ValueOf(fn).Type().In(ia.decodeIdx)
+	object := newDecodeTarget(inArg)
+
+	switch u := object.Interface().(type) {
+	case Unmarshaler:
+		err = u.Unmarshal(b)
+	case encoding.BinaryUnmarshaler:
+		err = u.UnmarshalBinary(b)
+	}
+
+	if err != nil {
+		return nil, ErrorWithCode{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	callValues[ia.decodeIdx] = decodeTargetValue(inArg, object)
+
+	return callValues, nil
+}
@@ -0,0 +1,205 @@
+package autohttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/fortytw2/autohttp/internal/msgpack"
+)
+
+// Request and response encodings understood by Client, matching the
+// decoders and encoders of a route
+const (
+	ClientJSON    = "json"
+	ClientMsgpack = "msgpack"
+	ClientQuery   = "query"
+	ClientForm    = "form"
+)
+
+// maxClientErrorBytes caps how much of an error response is read
+const maxClientErrorBytes = 1 << 20
+
+// Client is the runtime used by generated clients to call an autohttp server
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Header is sent with every request
+	Header http.Header
+}
+
+// ClientCall describes a single request made by a generated client
+type ClientCall struct {
+	Method string
+
+	// Path is the escaped request path, with params already filled in
+	Path   string
+	Header Header
+
+	// Input is encoded as InputEncoding, and Output decoded as
+	// OutputEncoding. Either may be empty when the route has none
+	Input          interface{}
+	InputEncoding  string
+	OutputEncoding string
+}
+
+// Do sends call, decoding the response body into out. Error responses are
+// returned as *ErrorWithCode, with FieldErrors when the server sent them
+func (c *Client) Do(ctx context.Context, call ClientCall, out interface{}) error {
+	req, err := c.newRequest(ctx, call)
+	if err != nil {
+		return err
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return decodeClientError(resp)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	switch call.OutputEncoding {
+	case ClientJSON:
+		return json.NewDecoder(resp.Body).Decode(out)
+	case ClientMsgpack:
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return msgpack.Unmarshal(b, out)
+	}
+
+	return fmt.Errorf("unsupported output encoding %q", call.OutputEncoding)
+}
+
+func (c *Client) newRequest(ctx context.Context, call ClientCall) (*http.Request, error) {
+	target := strings.TrimSuffix(c.BaseURL, "/") + call.Path
+
+	var (
+		body        io.Reader
+		contentType string
+	)
+	switch call.InputEncoding {
+	case "":
+	case ClientJSON:
+		b, err := json.Marshal(call.Input)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	case ClientMsgpack:
+		b, err := msgpack.Marshal(call.Input)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = bytes.NewReader(b), "application/msgpack"
+	case ClientQuery, ClientForm:
+		if call.Input == nil {
+			if call.InputEncoding == ClientForm {
+				body, contentType = http.NoBody, "application/x-www-form-urlencoded"
+			}
+			break
+		}
+
+		vs, err := compileValuesStruct(reflect.TypeOf(call.Input), call.InputEncoding)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := vs.encode(reflect.ValueOf(call.Input))
+		if err != nil {
+			return nil, err
+		}
+
+		if call.InputEncoding == ClientQuery {
+			if encoded := values.Encode(); encoded != "" {
+				target += "?" + encoded
+			}
+		} else {
+			body, contentType = strings.NewReader(values.Encode()), "application/x-www-form-urlencoded"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported input encoding %q", call.InputEncoding)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, call.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// continue the trace of the request calling us, if any
+	InjectTraceContext(ctx, req.Header)
+
+	for k, vals := range c.Header {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+
+	for k, v := range call.Header {
+		req.Header.Set(k, v)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	switch call.OutputEncoding {
+	case ClientJSON:
+		req.Header.Set("Accept", "application/json")
+	case ClientMsgpack:
+		req.Header.Set("Accept", "application/msgpack")
+	}
+
+	return req, nil
+}
+
+// decodeClientError reads the error bodies written by DefaultErrorHandler
+// and ProblemErrorHandler, falling back to the status text
+func decodeClientError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxClientErrorBytes))
+
+	var body struct {
+		Error  string      `json:"error"`
+		Title  string      `json:"title"`
+		Detail string      `json:"detail"`
+		Errors FieldErrors `json:"errors"`
+	}
+	json.Unmarshal(b, &body)
+
+	var err error
+	switch {
+	case len(body.Errors) > 0:
+		err = body.Errors
+	case body.Error != "":
+		err = errors.New(body.Error)
+	case body.Detail != "":
+		err = errors.New(body.Detail)
+	case body.Title != "":
+		err = errors.New(body.Title)
+	default:
+		err = errors.New(http.StatusText(resp.StatusCode))
+	}
+
+	return &ErrorWithCode{Err: err, StatusCode: resp.StatusCode}
+}
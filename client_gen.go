@@ -0,0 +1,361 @@
+package autohttp
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// autohttpImportPath is where generated clients find the Client runtime
+const autohttpImportPath = "github.com/fortytw2/autohttp"
+
+// GenerateGoClient emits the source of a Go package named pkg with a Client
+// that has one method per function route. Methods take the same input and
+// output types as the handler, plus a string for each path param, and
+// errors are returned as *ErrorWithCode.
+//
+// It is meant to be run from a small program invoked by go generate:
+//
+//	//go:generate go run ./cmd/genclient
+//
+// Every type used by a route must be exported from an importable package.
+// Routes the client cannot express return an error naming the route, and
+// can be left out with HideFromIntrospectors
+func (r *Router) GenerateGoClient(pkg string) ([]byte, error) {
+	g := &goClientGenerator{imports: map[string]string{
+		autohttpImportPath: "autohttp",
+		"context":          "context",
+		"net/http":         "http",
+		"net/url":          "url",
+	}}
+
+	var methods bytes.Buffer
+	for _, route := range r.introspectRoutes() {
+		err := g.writeMethod(&methods, route)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", route.method, route.pattern, err)
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by autohttp; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	src.WriteString(g.importBlock())
+	fmt.Fprintf(&src, `
+// Client calls the routes of an autohttp server
+type Client struct {
+	*autohttp.Client
+}
+
+// NewClient returns a Client for the server at baseURL. A nil hc uses
+// http.DefaultClient
+func NewClient(baseURL string, hc *http.Client) *Client {
+	return &Client{Client: &autohttp.Client{BaseURL: baseURL, HTTPClient: hc}}
+}
+`)
+	src.Write(methods.Bytes())
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("could not format generated client: %w", err)
+	}
+
+	return out, nil
+}
+
+type goClientGenerator struct {
+	// imports maps import paths to the name used in generated code
+	imports map[string]string
+	usesURL bool
+}
+
+func (g *goClientGenerator) importBlock() string {
+	paths := make([]string, 0, len(g.imports))
+	for p := range g.imports {
+		if p == "net/url" && !g.usesURL {
+			continue
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	// standard library first, as goimports would
+	sort.SliceStable(paths, func(i, j int) bool {
+		return isStdlibPath(paths[i]) && !isStdlibPath(paths[j])
+	})
+
+	var b strings.Builder
+	b.WriteString("import (\n")
+	for i, p := range paths {
+		if i > 0 && isStdlibPath(paths[i-1]) && !isStdlibPath(p) {
+			b.WriteString("\n")
+		}
+
+		if path.Base(p) == g.imports[p] {
+			fmt.Fprintf(&b, "\t%q\n", p)
+		} else {
+			fmt.Fprintf(&b, "\t%s %q\n", g.imports[p], p)
+		}
+	}
+	b.WriteString(")\n")
+
+	return b.String()
+}
+
+func isStdlibPath(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// qualifier returns the name used to refer to the package at importPath
+func (g *goClientGenerator) qualifier(importPath string) string {
+	if name, ok := g.imports[importPath]; ok {
+		return name
+	}
+
+	base := strings.Map(func(c rune) rune {
+		if c == '.' || c == '-' {
+			return '_'
+		}
+		return c
+	}, path.Base(importPath))
+
+	name := base
+	for n := 2; g.nameTaken(name); n++ {
+		name = base + strconv.Itoa(n)
+	}
+
+	g.imports[importPath] = name
+	return name
+}
+
+func (g *goClientGenerator) nameTaken(name string) bool {
+	for _, n := range g.imports {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// typeString spells t in generated code, importing its package
+func (g *goClientGenerator) typeString(t reflect.Type) (string, error) {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name(), nil
+		}
+
+		if t.PkgPath() == "main" || !isExportedName(t.Name()) {
+			return "", fmt.Errorf("type %s cannot be imported by a client", t)
+		}
+
+		return g.qualifier(t.PkgPath()) + "." + t.Name(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := g.typeString(t.Elem())
+		return "*" + elem, err
+	case reflect.Slice:
+		elem, err := g.typeString(t.Elem())
+		return "[]" + elem, err
+	case reflect.Array:
+		elem, err := g.typeString(t.Elem())
+		return "[" + strconv.Itoa(t.Len()) + "]" + elem, err
+	case reflect.Map:
+		key, err := g.typeString(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.typeString(t.Elem())
+		return "map[" + key + "]" + elem, err
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}", nil
+		}
+	}
+
+	return "", fmt.Errorf("type %s cannot be named by a client", t)
+}
+
+func isExportedName(name string) bool {
+	return name != "" && strings.ToUpper(name[:1]) == name[:1]
+}
+
+// inputEncoding picks how a client sends the decoded argument to d
+func inputEncoding(d Decoder) (string, error) {
+	switch dec := d.(type) {
+	case *JSONDecoder:
+		return ClientJSON, nil
+	case *MsgpackDecoder:
+		return ClientMsgpack, nil
+	case *QueryDecoder:
+		return ClientQuery, nil
+	case *FormDecoder:
+		return ClientForm, nil
+	case *ContentTypeDecoder:
+		// prefer JSON, then whichever supported decoder sorts first
+		var found string
+		for _, mt := range dec.mediaTypes() {
+			enc, err := inputEncoding(dec.decoders[mt])
+			if err != nil {
+				continue
+			}
+			if enc == ClientJSON {
+				return enc, nil
+			}
+			if found == "" {
+				found = enc
+			}
+		}
+
+		if found != "" {
+			return found, nil
+		}
+	}
+
+	return "", fmt.Errorf("decoder %T is not supported by generated clients", d)
+}
+
+// clientEncodingConst names the Client constant for enc in generated code
+func clientEncodingConst(enc string) string {
+	switch enc {
+	case ClientMsgpack:
+		return "autohttp.ClientMsgpack"
+	case ClientQuery:
+		return "autohttp.ClientQuery"
+	case ClientForm:
+		return "autohttp.ClientForm"
+	}
+
+	return "autohttp.ClientJSON"
+}
+
+// outputEncoding picks how a client reads the response written by e
+func outputEncoding(e Encoder) (string, error) {
+	switch enc := e.(type) {
+	case *JSONEncoder:
+		return ClientJSON, nil
+	case *MsgpackEncoder:
+		return ClientMsgpack, nil
+	case *NegotiatingEncoder:
+		for _, sub := range enc.encoders {
+			if oe, err := outputEncoding(sub); err == nil {
+				return oe, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("encoder %T is not supported by generated clients", e)
+}
+
+func (g *goClientGenerator) writeMethod(w *bytes.Buffer, route introspectedRoute) error {
+	tokens, err := parsePattern(route.pattern)
+	if err != nil {
+		return err
+	}
+
+	fnType := reflect.TypeOf(route.handler.fn)
+	params := []string{"ctx context.Context"}
+	call := []string{"Method: " + strconv.Quote(route.method)}
+
+	var pathExpr []string
+	for _, tok := range tokens {
+		switch {
+		case tok.param == "":
+			if tok.static != "" {
+				pathExpr = append(pathExpr, strconv.Quote(tok.static))
+			}
+		case tok.catchAll:
+			name := goParamName(tok.param)
+			params = append(params, name+" string")
+			pathExpr = append(pathExpr, "(&url.URL{Path: "+name+"}).EscapedPath()")
+			g.usesURL = true
+		default:
+			name := goParamName(tok.param)
+			params = append(params, name+" string")
+			pathExpr = append(pathExpr, "url.PathEscape("+name+")")
+			g.usesURL = true
+		}
+	}
+	call = append(call, "Path: "+strings.Join(pathExpr, " + "))
+
+	for i := 0; i < fnType.NumIn(); i++ {
+		if isHeaderType(fnType.In(i)) {
+			params = append(params, "header autohttp.Header")
+			call = append(call, "Header: header")
+		}
+	}
+
+	if in := route.decodeType(); in != nil {
+		typ, err := g.typeString(in)
+		if err != nil {
+			return err
+		}
+
+		enc, err := inputEncoding(route.handler.decoder)
+		if err != nil {
+			return err
+		}
+
+		params = append(params, "in "+typ)
+		call = append(call, "Input: in", "InputEncoding: "+clientEncodingConst(enc))
+	} else if enc, err := inputEncoding(route.handler.decoder); err == nil {
+		// decoders such as JSONDecoder check the content type even when
+		// the function takes no input
+		call = append(call, "InputEncoding: "+clientEncodingConst(enc))
+	}
+
+	name := upperFirst(goIdentifier(route.name))
+	fmt.Fprintf(w, "\n// %s calls %s %s\n", name, route.method, route.pattern)
+
+	// a Response envelope's body is only known at runtime, so it decodes
+	// into an interface{}
+	out := route.response().body
+	if out == nil {
+		fmt.Fprintf(w, "func (c *Client) %s(%s) error {\n", name, strings.Join(params, ", "))
+		fmt.Fprintf(w, "return c.Client.Do(ctx, autohttp.ClientCall{%s}, nil)\n}\n", strings.Join(call, ", "))
+		return nil
+	}
+
+	typ, err := g.typeString(out)
+	if err != nil {
+		return err
+	}
+
+	enc, err := outputEncoding(route.handler.encoder)
+	if err != nil {
+		return err
+	}
+	call = append(call, "OutputEncoding: "+clientEncodingConst(enc))
+
+	fmt.Fprintf(w, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(params, ", "), typ)
+	fmt.Fprintf(w, "var out %s\n", typ)
+	fmt.Fprintf(w, "err := c.Client.Do(ctx, autohttp.ClientCall{%s}, &out)\n", strings.Join(call, ", "))
+	fmt.Fprintf(w, "return out, err\n}\n")
+
+	return nil
+}
+
+// goParamName turns a path param into a Go identifier that cannot clash
+// with the other arguments of a generated method
+func goParamName(param string) string {
+	if param == anonymousCatchAll {
+		param = wildcardParamName
+	}
+
+	return "p" + upperFirst(goIdentifier(param))
+}
+
+// goIdentifier replaces characters that cannot appear in a Go identifier
+func goIdentifier(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			return c
+		}
+		return '_'
+	}, s)
+}
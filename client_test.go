@@ -0,0 +1,195 @@
+package autohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+type ClientTestUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name" validate:"required"`
+}
+
+type ClientTestSearch struct {
+	Query string   `query:"q"`
+	Tags  []string `query:"tag"`
+	Page  *int     `query:"page"`
+}
+
+type clientTestHidden struct{}
+
+func createClientTestUser(ctx context.Context, u *ClientTestUser) (*ClientTestUser, error) {
+	u.ID = "1"
+	return u, nil
+}
+
+func newClientTestRouter(t *testing.T, opts ...RouterOption) *Router {
+	t.Helper()
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := []struct {
+		method string
+		path   string
+		fn     interface{}
+		opts   []RouteOption
+	}{
+		{http.MethodPost, "/users", createClientTestUser, nil},
+		{http.MethodGet, "/users/{id}", func(ctx context.Context, p PathParams) (ClientTestUser, error) {
+			if p["id"] == "missing" {
+				return ClientTestUser{}, NewErrorWithCode(errors.New("no such user"), http.StatusNotFound)
+			}
+			return ClientTestUser{ID: p["id"]}, nil
+		}, []RouteOption{WithRouteName("getUser"), WithRouteDecoder(NewQueryDecoder())}},
+		{http.MethodGet, "/search", func(ctx context.Context, s *ClientTestSearch) ([]string, error) {
+			out := append([]string{s.Query}, s.Tags...)
+			if s.Page != nil {
+				out = append(out, "page")
+			}
+			return out, nil
+		}, []RouteOption{WithRouteDecoder(NewQueryDecoder()), WithRouteName("search")}},
+		{http.MethodDelete, "/files/{path...}", func(ctx context.Context, p PathParams) error {
+			return nil
+		}, []RouteOption{WithRouteName("deleteFile"), WithRouteDecoder(NewQueryDecoder())}},
+		{http.MethodPost, "/envelope", func(ctx context.Context) (*Response, error) {
+			return &Response{StatusCode: http.StatusCreated, Body: map[string]bool{"ok": true}}, nil
+		}, []RouteOption{WithRouteName("envelope")}},
+		{http.MethodGet, "/hidden", func() (clientTestHidden, error) {
+			return clientTestHidden{}, nil
+		}, []RouteOption{HideFromIntrospectors, WithRouteDecoder(NoOpDecoder{})}},
+	}
+
+	for _, rt := range routes {
+		err := r.Register(rt.method, rt.path, rt.fn, rt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return r
+}
+
+func TestGenerateGoClient(t *testing.T) {
+	r := newClientTestRouter(t)
+
+	src, err := r.GenerateGoClient("userclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{
+		"package userclient",
+		`"net/url"`,
+		"func (c *Client) CreateClientTestUser(ctx context.Context, in *autohttp.ClientTestUser) (*autohttp.ClientTestUser, error) {",
+		"func (c *Client) GetUser(ctx context.Context, pId string) (autohttp.ClientTestUser, error) {",
+		`Path: "/users/" + url.PathEscape(pId)`,
+		"func (c *Client) Search(ctx context.Context, in *autohttp.ClientTestSearch) ([]string, error) {",
+		"InputEncoding: autohttp.ClientQuery",
+		"func (c *Client) DeleteFile(ctx context.Context, pPath string) error {",
+		"func (c *Client) Envelope(ctx context.Context) (interface{}, error) {",
+	} {
+		if !strings.Contains(string(src), expect) {
+			t.Errorf("expected generated client to contain %q\n%s", expect, src)
+		}
+	}
+
+	if strings.Contains(string(src), "clientTestHidden") {
+		t.Error("hidden route was generated")
+	}
+
+	err = r.Register(http.MethodGet, "/unexported", func(ctx context.Context) (clientTestHidden, error) {
+		return clientTestHidden{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.GenerateGoClient("userclient")
+	if err == nil || !strings.Contains(err.Error(), "/unexported") {
+		t.Errorf("expected an error naming the unexported route, got %v", err)
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	srv := httptest.NewServer(newClientTestRouter(t))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL}
+	ctx := context.Background()
+
+	var created *ClientTestUser
+	err := c.Do(ctx, ClientCall{Method: http.MethodPost, Path: "/users", Input: &ClientTestUser{Name: "a"}, InputEncoding: ClientJSON, OutputEncoding: ClientJSON}, &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.ID != "1" || created.Name != "a" {
+		t.Errorf("unexpected user %+v", created)
+	}
+
+	page := 2
+	var found []string
+	err = c.Do(ctx, ClientCall{Method: http.MethodGet, Path: "/search", Input: &ClientTestSearch{Query: "x", Tags: []string{"a", "b"}, Page: &page}, InputEncoding: ClientQuery, OutputEncoding: ClientJSON}, &found)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(found, ",") != "x,a,b,page" {
+		t.Errorf("unexpected search result %v", found)
+	}
+
+	err = c.Do(ctx, ClientCall{Method: http.MethodDelete, Path: "/files/a/b"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var enveloped interface{}
+	err = c.Do(ctx, ClientCall{Method: http.MethodPost, Path: "/envelope", InputEncoding: ClientJSON, OutputEncoding: ClientJSON}, &enveloped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(enveloped, map[string]interface{}{"ok": true}) {
+		t.Errorf("unexpected envelope body %v", enveloped)
+	}
+
+	// escaped as the generated GetUser does, a / stays inside the param
+	var fetched ClientTestUser
+	err = c.Do(ctx, ClientCall{Method: http.MethodGet, Path: "/users/" + url.PathEscape("a/b"), OutputEncoding: ClientJSON}, &fetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fetched.ID != "a/b" {
+		t.Errorf("expected the id to round trip, got %q", fetched.ID)
+	}
+
+	var ewc *ErrorWithCode
+	err = c.Do(ctx, ClientCall{Method: http.MethodGet, Path: "/users/missing", OutputEncoding: ClientJSON}, &ClientTestUser{})
+	if !errors.As(err, &ewc) || ewc.StatusCode != http.StatusNotFound || ewc.Error() != "no such user" {
+		t.Errorf("unexpected error %#v", err)
+	}
+
+	problemSrv := httptest.NewServer(newClientTestRouter(t, WithDefaultErrorHandler(ProblemErrorHandler)))
+	defer problemSrv.Close()
+
+	c.BaseURL = problemSrv.URL
+	err = c.Do(ctx, ClientCall{Method: http.MethodPost, Path: "/users", Input: &ClientTestUser{}, InputEncoding: ClientJSON, OutputEncoding: ClientJSON}, &created)
+
+	var fieldErrs FieldErrors
+	if !errors.As(err, &ewc) || ewc.StatusCode != http.StatusUnprocessableEntity || !errors.As(err, &fieldErrs) || fieldErrs[0].Field != "name" {
+		t.Errorf("unexpected error %#v", err)
+	}
+}
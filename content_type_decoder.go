@@ -0,0 +1,100 @@
+package autohttp
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ContentTypeDecoder dispatches each request to one of several decoders
+// based on its Content-Type, letting the same function accept, for example,
+// both HTML form posts and JSON API calls.
+//
+// Decoders are keyed by media type. Parameters such as charset are ignored,
+// and a structured syntax suffix (application/problem+json) falls back to the
+// decoder registered for application/<suffix>. A function must be compatible
+// with every decoder in the set
+type ContentTypeDecoder struct {
+	decoders map[string]Decoder
+}
+
+func NewContentTypeDecoder(decoders map[string]Decoder) *ContentTypeDecoder {
+	normalized := make(map[string]Decoder, len(decoders))
+	for mt, d := range decoders {
+		normalized[strings.ToLower(mt)] = d
+	}
+
+	return &ContentTypeDecoder{decoders: normalized}
+}
+
+func (ctd *ContentTypeDecoder) ValidateType(fn interface{}) error {
+	if len(ctd.decoders) == 0 {
+		return fmt.Errorf("content type decoder needs at least one decoder")
+	}
+
+	for _, mt := range ctd.mediaTypes() {
+		err := ctd.decoders[mt].ValidateType(fn)
+		if err != nil {
+			return fmt.Errorf("%s: %w", mt, err)
+		}
+	}
+
+	return nil
+}
+
+func (ctd *ContentTypeDecoder) mediaTypes() []string {
+	mts := make([]string, 0, len(ctd.decoders))
+	for mt := range ctd.decoders {
+		mts = append(mts, mt)
+	}
+	sort.Strings(mts)
+
+	return mts
+}
+
+// Decode returns the reflect values needed to call the fn
+// from the *http.Request
+func (ctd *ContentTypeDecoder) Decode(fn interface{}, r *http.Request) ([]reflect.Value, error) {
+	mediaType := requestMediaType(r)
+
+	d, ok := ctd.decoders[mediaType]
+	if !ok {
+		if suffix := mediaTypeSuffix(mediaType); suffix != "" {
+			d, ok = ctd.decoders["application/"+suffix]
+		}
+	}
+
+	if !ok {
+		return nil, ErrorWithCode{
+			Err:        fmt.Errorf("unsupported content type %q, expected one of %s", mediaType, strings.Join(ctd.mediaTypes(), ", ")),
+			StatusCode: http.StatusUnsupportedMediaType,
+		}
+	}
+
+	return d.Decode(fn, r)
+}
+
+// requestMediaType returns the lowercased media type of the request body,
+// without any parameters
+func requestMediaType(r *http.Request) string {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return mt
+}
+
+// mediaTypeSuffix returns the structured syntax suffix of a media type,
+// such as json for application/vnd.api+json
+func mediaTypeSuffix(mediaType string) string {
+	idx := strings.LastIndexByte(mediaType, '+')
+	if idx == -1 {
+		return ""
+	}
+
+	return mediaType[idx+1:]
+}
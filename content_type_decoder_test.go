@@ -0,0 +1,178 @@
+package autohttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/autohttp/internal/msgpack"
+	"github.com/fortytw2/lounge"
+)
+
+type signup struct {
+	Email string `json:"email" form:"email" msgpack:"email"`
+}
+
+// rawMessage mimics a protobuf generated message
+type rawMessage struct {
+	Email string
+}
+
+func (rm *rawMessage) Unmarshal(b []byte) error {
+	rm.Email = string(b)
+	return nil
+}
+
+func TestContentTypeDecoderValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name      string
+		Decoders  map[string]Decoder
+		Fn        interface{}
+		ShouldErr bool
+	}{
+		{
+			"json-form-msgpack",
+			map[string]Decoder{
+				"application/json":                  NewJSONDecoder(),
+				"application/x-www-form-urlencoded": NewFormDecoder(),
+				"application/msgpack":               NewMsgpackDecoder(),
+			},
+			func(ctx context.Context, in signup) {},
+			false,
+		},
+		{
+			"form-rejects-slices",
+			map[string]Decoder{
+				"application/json":                  NewJSONDecoder(),
+				"application/x-www-form-urlencoded": NewFormDecoder(),
+			},
+			func(ctx context.Context, in []int) {},
+			true,
+		},
+		{
+			"binary-needs-unmarshaler",
+			map[string]Decoder{
+				"application/x-protobuf": NewBinaryDecoder(),
+			},
+			func(ctx context.Context, in signup) {},
+			true,
+		},
+		{
+			"binary-unmarshaler",
+			map[string]Decoder{
+				"application/x-protobuf": NewBinaryDecoder(),
+			},
+			func(ctx context.Context, in *rawMessage) {},
+			false,
+		},
+		{
+			"empty",
+			map[string]Decoder{},
+			func(ctx context.Context) {},
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := NewContentTypeDecoder(c.Decoders).ValidateType(c.Fn)
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
+
+func TestContentTypeDecoder(t *testing.T) {
+	var got string
+	fn := func(ctx context.Context, in signup) {
+		got = in.Email
+	}
+
+	ctd := NewContentTypeDecoder(map[string]Decoder{
+		"application/json":                  NewJSONDecoder(),
+		"application/x-www-form-urlencoded": NewFormDecoder(),
+		"application/msgpack":               NewMsgpackDecoder(),
+	})
+
+	msgpackBody, err := msgpack.Marshal(signup{Email: "msgpack@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name         string
+		ContentType  string
+		Body         io.Reader
+		ExpectStatus int
+		ExpectEmail  string
+	}{
+		{"json", "application/json", strings.NewReader(`{"email":"json@example.com"}`), http.StatusNoContent, "json@example.com"},
+		{"json-charset", "Application/JSON; charset=utf-8", strings.NewReader(`{"email":"json@example.com"}`), http.StatusNoContent, "json@example.com"},
+		{"json-suffix", "application/vnd.api+json", strings.NewReader(`{"email":"suffix@example.com"}`), http.StatusNoContent, "suffix@example.com"},
+		{"form", "application/x-www-form-urlencoded", strings.NewReader(`email=form%40example.com`), http.StatusNoContent, "form@example.com"},
+		{"msgpack", "application/msgpack", bytes.NewReader(msgpackBody), http.StatusNoContent, "msgpack@example.com"},
+		{"bad-msgpack", "application/msgpack", bytes.NewReader([]byte{0xc1}), http.StatusBadRequest, ""},
+		{"unsupported", "text/plain", strings.NewReader(`hi`), http.StatusUnsupportedMediaType, ""},
+		{"missing", "", strings.NewReader(`hi`), http.StatusUnsupportedMediaType, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			got = ""
+
+			ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), ctd, NoOpEncoder{}, DefaultErrorHandler, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", c.Body)
+			if c.ContentType != "" {
+				r.Header.Set("Content-Type", c.ContentType)
+			}
+
+			ar.ServeHTTP(w, r)
+
+			if w.Code != c.ExpectStatus {
+				t.Fatalf("expected %d got %d: %s", c.ExpectStatus, w.Code, w.Body.String())
+			}
+
+			if got != c.ExpectEmail {
+				t.Errorf("expected %q got %q", c.ExpectEmail, got)
+			}
+		})
+	}
+}
+
+func TestBinaryDecoder(t *testing.T) {
+	var got string
+	fn := func(ctx context.Context, in *rawMessage) {
+		got = in.Email
+	}
+
+	ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NewBinaryDecoder(), NoOpEncoder{}, DefaultErrorHandler, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("binary@example.com"))
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	ar.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent || got != "binary@example.com" {
+		t.Errorf("unexpected result %d %q", w.Code, got)
+	}
+}
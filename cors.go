@@ -0,0 +1,232 @@
+package autohttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CORSPolicy allows browsers on other origins to call routes on the Router
+type CORSPolicy struct {
+	// AllowedOrigins are matched exactly, such as https://example.com, or
+	// by subdomain, such as https://*.example.com. "*" allows any origin
+	AllowedOrigins []string
+	// AllowOriginFunc is consulted for origins not in AllowedOrigins
+	AllowOriginFunc func(origin string, r *http.Request) bool
+
+	// AllowedMethods narrows the methods offered in preflight responses,
+	// which otherwise are every method registered for the path
+	AllowedMethods []string
+	// AllowedHeaders defaults to Content-Type, which every decoder but the
+	// NoOpDecoder relies on. "*" allows any header the browser asks for
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+func (cp *CORSPolicy) validate() error {
+	for _, o := range cp.AllowedOrigins {
+		if o == "*" {
+			if cp.AllowCredentials {
+				return errors.New("autohttp: a CORS policy allowing credentials cannot allow every origin")
+			}
+			continue
+		}
+
+		if strings.Contains(o, "*") && !strings.Contains(o, "://*.") {
+			return fmt.Errorf("autohttp: invalid CORS origin %q, wildcards must cover a whole subdomain", o)
+		}
+	}
+
+	return nil
+}
+
+// anyOrigin reports whether the policy allows every origin, so responses
+// can use * and do not vary by Origin
+func (cp *CORSPolicy) anyOrigin() bool {
+	for _, o := range cp.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cp *CORSPolicy) allowsOrigin(origin string, r *http.Request) bool {
+	lower := strings.ToLower(origin)
+	for _, o := range cp.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == "*" || o == lower {
+			return true
+		}
+
+		idx := strings.Index(o, "://*.")
+		if idx == -1 {
+			continue
+		}
+
+		// https://*.example.com matches https://a.example.com and
+		// https://a.b.example.com, but not https://example.com
+		scheme, suffix := o[:idx+3], o[idx+4:]
+		if strings.HasPrefix(lower, scheme) && strings.HasSuffix(lower, suffix) &&
+			len(lower) > len(scheme)+len(suffix) && !strings.Contains(lower[len(scheme):len(lower)-len(suffix)], "/") {
+			return true
+		}
+	}
+
+	return cp.AllowOriginFunc != nil && cp.AllowOriginFunc(origin, r)
+}
+
+func (cp *CORSPolicy) allowsMethod(method string) bool {
+	if len(cp.AllowedMethods) == 0 {
+		return true
+	}
+
+	for _, m := range cp.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowedHeaders answers a preflight asking to send requested
+func (cp *CORSPolicy) allowedHeaders(requested string) string {
+	if len(cp.AllowedHeaders) == 0 {
+		return "Content-Type"
+	}
+
+	for _, h := range cp.AllowedHeaders {
+		if h == "*" {
+			return requested
+		}
+	}
+
+	return strings.Join(cp.AllowedHeaders, ", ")
+}
+
+// writeOrigin sets the headers common to preflight and actual responses,
+// reporting whether the origin is allowed
+func (cp *CORSPolicy) writeOrigin(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+
+	anyOrigin := cp.anyOrigin()
+	if !anyOrigin {
+		h.Add("Vary", "Origin")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !cp.allowsOrigin(origin, r) {
+		return false
+	}
+
+	if anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if cp.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	return true
+}
+
+// WithCORS applies cp to every route on the Router
+func WithCORS(cp *CORSPolicy) func(r *Router) error {
+	return func(r *Router) error {
+		err := cp.validate()
+		if err != nil {
+			return err
+		}
+
+		r.cors = cp
+		return nil
+	}
+}
+
+// WithRouteCORS overrides the Router's CORSPolicy for a single route
+func WithRouteCORS(cp *CORSPolicy) RouteOption {
+	return func(rc *routeConfig) error {
+		err := cp.validate()
+		if err != nil {
+			return err
+		}
+
+		rc.cors = cp
+		return nil
+	}
+}
+
+// corsHandler adds CORS headers to the actual, non-preflight, response
+type corsHandler struct {
+	policy *CORSPolicy
+	next   http.Handler
+}
+
+func (ch *corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ch.policy.writeOrigin(w, r) && len(ch.policy.ExposedHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(ch.policy.ExposedHeaders, ", "))
+	}
+
+	ch.next.ServeHTTP(w, r)
+}
+
+// serveOptions answers an OPTIONS request for a path served by methods,
+// including CORS preflights
+func (r *Router) serveOptions(w http.ResponseWriter, req *http.Request, methods []string) {
+	w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+
+	requestMethod := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+	if req.Header.Get("Origin") == "" || requestMethod == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// the policy of the route the browser wants to call answers for it
+	var policy *CORSPolicy
+	if node, method, _ := r.findRoute(req.URL, requestMethod); node != nil {
+		policy = r.routeCORS[method][node.pattern]
+	}
+
+	if policy == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if !policy.writeOrigin(w, req) || !policy.allowsMethod(requestMethod) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var allowed []string
+	for _, m := range methods {
+		if policy.allowsMethod(m) {
+			allowed = append(allowed, m)
+		}
+	}
+
+	h.Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+
+	if headers := policy.allowedHeaders(req.Header.Get("Access-Control-Request-Headers")); headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+
+	if policy.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(policy.MaxAge/time.Second), 10))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
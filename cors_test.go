@@ -0,0 +1,206 @@
+package autohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestCORSPolicyValidate(t *testing.T) {
+	cases := []struct {
+		Name      string
+		Policy    *CORSPolicy
+		ShouldErr bool
+	}{
+		{"exact", &CORSPolicy{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true}, false},
+		{"subdomain", &CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, false},
+		{"any", &CORSPolicy{AllowedOrigins: []string{"*"}}, false},
+		{"any-with-credentials", &CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}, true},
+		{"partial-wildcard", &CORSPolicy{AllowedOrigins: []string{"https://app-*.example.com"}}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := c.Policy.validate()
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
+
+func TestCORSRouter(t *testing.T) {
+	policy := &CORSPolicy{
+		AllowedOrigins: []string{"https://example.com", "https://*.example.org"},
+		AllowOriginFunc: func(origin string, r *http.Request) bool {
+			return strings.HasSuffix(origin, ".localhost:3000")
+		},
+		AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithCORS(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := func(ctx context.Context) error { return nil }
+
+	err = r.Register(http.MethodPost, "/users/{id}", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodDelete, "/users/{id}", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/public", fn, WithRouteCORS(&CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"*"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name          string
+		Method        string
+		Path          string
+		Header        http.Header
+		ExpectStatus  int
+		ExpectHeaders map[string]string
+	}{
+		{
+			"plain-options",
+			http.MethodOptions,
+			"/users/1",
+			nil,
+			http.StatusNoContent,
+			map[string]string{"Allow": "DELETE, POST, OPTIONS", "Access-Control-Allow-Origin": ""},
+		},
+		{
+			"preflight",
+			http.MethodOptions,
+			"/users/1",
+			http.Header{"Origin": {"https://example.com"}, "Access-Control-Request-Method": {"DELETE"}},
+			http.StatusNoContent,
+			map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Methods":     "DELETE, POST",
+				"Access-Control-Allow-Headers":     "Content-Type, X-Request-ID",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			"preflight-subdomain",
+			http.MethodOptions,
+			"/users/1",
+			http.Header{"Origin": {"https://a.b.example.org"}, "Access-Control-Request-Method": {"POST"}},
+			http.StatusNoContent,
+			map[string]string{"Access-Control-Allow-Origin": "https://a.b.example.org"},
+		},
+		{
+			"preflight-func",
+			http.MethodOptions,
+			"/users/1",
+			http.Header{"Origin": {"http://dev.localhost:3000"}, "Access-Control-Request-Method": {"POST"}},
+			http.StatusNoContent,
+			map[string]string{"Access-Control-Allow-Origin": "http://dev.localhost:3000"},
+		},
+		{
+			"preflight-bare-domain",
+			http.MethodOptions,
+			"/users/1",
+			http.Header{"Origin": {"https://example.org"}, "Access-Control-Request-Method": {"POST"}},
+			http.StatusNoContent,
+			map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			"preflight-unregistered-method",
+			http.MethodOptions,
+			"/users/1",
+			http.Header{"Origin": {"https://example.com"}, "Access-Control-Request-Method": {"PUT"}},
+			http.StatusNoContent,
+			map[string]string{"Access-Control-Allow-Origin": "", "Allow": "DELETE, POST, OPTIONS"},
+		},
+		{
+			"preflight-route-policy",
+			http.MethodOptions,
+			"/public",
+			http.Header{"Origin": {"https://anywhere.com"}, "Access-Control-Request-Method": {"POST"}, "Access-Control-Request-Headers": {"x-custom"}},
+			http.StatusNoContent,
+			map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Headers":     "x-custom",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Max-Age":           "",
+			},
+		},
+		{
+			"options-unknown-path",
+			http.MethodOptions,
+			"/missing",
+			http.Header{"Origin": {"https://example.com"}, "Access-Control-Request-Method": {"POST"}},
+			http.StatusNotFound,
+			nil,
+		},
+		{
+			"actual-request",
+			http.MethodPost,
+			"/users/1",
+			http.Header{"Origin": {"https://example.com"}, "Content-Type": {"application/json"}},
+			http.StatusOK,
+			map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+				"Access-Control-Allow-Credentials": "true",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			"actual-request-disallowed",
+			http.MethodPost,
+			"/users/1",
+			http.Header{"Origin": {"https://evil.com"}, "Content-Type": {"application/json"}},
+			http.StatusOK,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			req := httptest.NewRequest(c.Method, c.Path, strings.NewReader(`{}`))
+			for k, v := range c.Header {
+				req.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != c.ExpectStatus {
+				t.Errorf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+
+			for k, v := range c.ExpectHeaders {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("expected %s=%q got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package autohttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// CSPSource is a source expression in a Content-Security-Policy directive
+type CSPSource string
+
+const (
+	CSPSelf           CSPSource = "'self'"
+	CSPNone           CSPSource = "'none'"
+	CSPUnsafeInline   CSPSource = "'unsafe-inline'"
+	CSPUnsafeEval     CSPSource = "'unsafe-eval'"
+	CSPStrictDynamic  CSPSource = "'strict-dynamic'"
+	CSPReportSample   CSPSource = "'report-sample'"
+	CSPData           CSPSource = "data:"
+	CSPBlob           CSPSource = "blob:"
+	CSPHTTPS          CSPSource = "https:"
+	CSPWasmUnsafeEval CSPSource = "'wasm-unsafe-eval'"
+
+	// CSPNonce is replaced with 'nonce-...' holding the nonce generated for
+	// each request, which templates read with GetCSPNonce
+	CSPNonce CSPSource = "'nonce'"
+)
+
+// CSPHost returns a host source such as https://cdn.example.com
+func CSPHost(host string) CSPSource {
+	return CSPSource(host)
+}
+
+// CSPHash returns a hash source for an inline script or style, such as
+// CSPHash("sha256", "<base64 digest>")
+func CSPHash(algorithm, digest string) CSPSource {
+	return CSPSource("'" + algorithm + "-" + digest + "'")
+}
+
+// cspReportGroup names the Reporting-Endpoints group used by report-to
+const cspReportGroup = "csp-endpoint"
+
+type cspDirective struct {
+	name    string
+	sources []CSPSource
+}
+
+// ContentSecurityPolicy builds a Content-Security-Policy header. Directives
+// are written in the order they are first set, and setting a directive
+// again adds to its sources
+type ContentSecurityPolicy struct {
+	directives []cspDirective
+	reportOnly bool
+	reportURI  string
+}
+
+func NewContentSecurityPolicy() *ContentSecurityPolicy {
+	return &ContentSecurityPolicy{}
+}
+
+// Directive adds sources to any directive by name, for directives without
+// a dedicated method
+func (csp *ContentSecurityPolicy) Directive(name string, sources ...CSPSource) *ContentSecurityPolicy {
+	for i := range csp.directives {
+		if csp.directives[i].name == name {
+			csp.directives[i].sources = append(csp.directives[i].sources, sources...)
+			return csp
+		}
+	}
+
+	csp.directives = append(csp.directives, cspDirective{name: name, sources: sources})
+	return csp
+}
+
+func (csp *ContentSecurityPolicy) DefaultSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("default-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) ScriptSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("script-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) StyleSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("style-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) ImgSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("img-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) ConnectSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("connect-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) FontSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("font-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) ObjectSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("object-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) MediaSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("media-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) FrameSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("frame-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) WorkerSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("worker-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) ManifestSrc(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("manifest-src", sources...)
+}
+
+func (csp *ContentSecurityPolicy) FrameAncestors(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("frame-ancestors", sources...)
+}
+
+func (csp *ContentSecurityPolicy) BaseURI(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("base-uri", sources...)
+}
+
+func (csp *ContentSecurityPolicy) FormAction(sources ...CSPSource) *ContentSecurityPolicy {
+	return csp.Directive("form-action", sources...)
+}
+
+// UpgradeInsecureRequests asks browsers to load http:// resources over https://
+func (csp *ContentSecurityPolicy) UpgradeInsecureRequests() *ContentSecurityPolicy {
+	return csp.Directive("upgrade-insecure-requests")
+}
+
+// ReportOnly sends the policy as Content-Security-Policy-Report-Only, so
+// violations are reported but not blocked
+func (csp *ContentSecurityPolicy) ReportOnly() *ContentSecurityPolicy {
+	csp.reportOnly = true
+	return csp
+}
+
+// ReportURI sends violation reports to uri. WithCSPReportRoute sets this
+// to its own path
+func (csp *ContentSecurityPolicy) ReportURI(uri string) *ContentSecurityPolicy {
+	csp.reportURI = uri
+	return csp
+}
+
+// HeaderName is the header the policy is sent in
+func (csp *ContentSecurityPolicy) HeaderName() string {
+	if csp.reportOnly {
+		return "Content-Security-Policy-Report-Only"
+	}
+	return "Content-Security-Policy"
+}
+
+// usesNonce reports whether any directive asks for a per-request nonce
+func (csp *ContentSecurityPolicy) usesNonce() bool {
+	for _, d := range csp.directives {
+		for _, s := range d.sources {
+			if s == CSPNonce {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String renders the policy with nonce in place of CSPNonce
+func (csp *ContentSecurityPolicy) String(nonce string) string {
+	parts := make([]string, 0, len(csp.directives)+2)
+	for _, d := range csp.directives {
+		var b strings.Builder
+		b.WriteString(d.name)
+		for _, s := range d.sources {
+			if s == CSPNonce {
+				if nonce == "" {
+					continue
+				}
+				s = CSPSource("'nonce-" + nonce + "'")
+			}
+			b.WriteString(" " + string(s))
+		}
+		parts = append(parts, b.String())
+	}
+
+	if csp.reportURI != "" {
+		parts = append(parts, "report-uri "+csp.reportURI, "report-to "+cspReportGroup)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+type cspNonceKey struct{}
+
+// GetCSPNonce returns the nonce generated for r, for use in the nonce
+// attribute of inline <script> and <style> tags. It is empty unless the
+// Router's policy uses CSPNonce
+func GetCSPNonce(r *http.Request) string {
+	return CSPNonceFromContext(r.Context())
+}
+
+// CSPNonceFromContext is GetCSPNonce for functions, which are given the
+// context.Context of the request rather than the request itself
+func CSPNonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey{}).(string)
+	return nonce
+}
+
+func newCSPNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// WithContentSecurityPolicy sends csp with every response from the Router,
+// including embedded assets
+func WithContentSecurityPolicy(csp *ContentSecurityPolicy) func(r *Router) error {
+	return func(r *Router) error {
+		r.csp = csp
+		return nil
+	}
+}
+
+// applyCSP sets the policy header on w, returning req carrying the nonce
+func (r *Router) applyCSP(w http.ResponseWriter, req *http.Request) *http.Request {
+	if r.csp == nil {
+		return req
+	}
+
+	var nonce string
+	if r.csp.usesNonce() {
+		var err error
+		nonce, err = newCSPNonce()
+		if err != nil {
+			r.log.Errorf("could not generate csp nonce: %s", err)
+		} else {
+			req = req.WithContext(context.WithValue(req.Context(), cspNonceKey{}, nonce))
+		}
+	}
+
+	w.Header().Set(r.csp.HeaderName(), r.csp.String(nonce))
+	if r.csp.reportURI != "" {
+		w.Header().Set("Reporting-Endpoints", fmt.Sprintf("%s=%q", cspReportGroup, r.csp.reportURI))
+	}
+
+	return req
+}
+
+// CSPReport is a single violation report, normalized from either the
+// application/csp-report or the application/reports+json format
+type CSPReport struct {
+	DocumentURI        string `json:"document_uri"`
+	Referrer           string `json:"referrer,omitempty"`
+	BlockedURI         string `json:"blocked_uri"`
+	EffectiveDirective string `json:"effective_directive"`
+	OriginalPolicy     string `json:"original_policy"`
+	Disposition        string `json:"disposition"`
+	SourceFile         string `json:"source_file,omitempty"`
+	Sample             string `json:"sample,omitempty"`
+	StatusCode         int    `json:"status_code,omitempty"`
+	LineNumber         int    `json:"line_number,omitempty"`
+	ColumnNumber       int    `json:"column_number,omitempty"`
+}
+
+// A CSPReportSink receives every violation report sent to the report route
+type CSPReportSink interface {
+	HandleCSPReport(r *http.Request, report CSPReport)
+}
+
+// CSPReportSinkFunc adapts a function to a CSPReportSink
+type CSPReportSinkFunc func(r *http.Request, report CSPReport)
+
+func (f CSPReportSinkFunc) HandleCSPReport(r *http.Request, report CSPReport) {
+	f(r, report)
+}
+
+// maxCSPReportBytes bounds the size of a report body
+const maxCSPReportBytes = 64 << 10
+
+// WithCSPReportRoute accepts violation reports at path, forwarding them to
+// sink, and points the Router's policy at it with report-uri and report-to.
+// A nil sink logs reports. It must be given after WithContentSecurityPolicy
+func WithCSPReportRoute(path string, sink CSPReportSink) func(r *Router) error {
+	return func(r *Router) error {
+		if r.csp == nil {
+			return errors.New("csp report route needs a policy, use WithContentSecurityPolicy first")
+		}
+
+		if sink == nil {
+			log := r.log
+			sink = CSPReportSinkFunc(func(req *http.Request, report CSPReport) {
+				log.Infof("csp violation on %s: %s blocked %s", report.DocumentURI, report.EffectiveDirective, report.BlockedURI)
+			})
+		}
+
+		r.csp.ReportURI(path)
+		r.registerAfterOptions(http.MethodPost, path, &cspReportHandler{sink: sink})
+		return nil
+	}
+}
+
+type cspReportHandler struct {
+	sink CSPReportSink
+}
+
+func (h *cspReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, err := readLimitedBody(r, maxCSPReportBytes)
+	if err != nil {
+		w.WriteHeader(statusCodeFor(err))
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	reports, err := parseCSPReports(mediaType, b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, report := range reports {
+		h.sink.HandleCSPReport(r, report)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// legacyCSPReport is the body of an application/csp-report request
+type legacyCSPReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		ScriptSample       string `json:"script-sample"`
+		StatusCode         int    `json:"status-code"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is one entry of an application/reports+json request
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		Sample             string `json:"sample"`
+		StatusCode         int    `json:"statusCode"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+	} `json:"body"`
+}
+
+func parseCSPReports(mediaType string, b []byte) ([]CSPReport, error) {
+	switch mediaType {
+	case "application/reports+json":
+		var entries []reportingAPIReport
+		err := json.Unmarshal(b, &entries)
+		if err != nil {
+			return nil, err
+		}
+
+		var reports []CSPReport
+		for _, e := range entries {
+			if e.Type != "csp-violation" {
+				continue
+			}
+
+			reports = append(reports, CSPReport{
+				DocumentURI:        e.Body.DocumentURL,
+				Referrer:           e.Body.Referrer,
+				BlockedURI:         e.Body.BlockedURL,
+				EffectiveDirective: e.Body.EffectiveDirective,
+				OriginalPolicy:     e.Body.OriginalPolicy,
+				Disposition:        e.Body.Disposition,
+				SourceFile:         e.Body.SourceFile,
+				Sample:             e.Body.Sample,
+				StatusCode:         e.Body.StatusCode,
+				LineNumber:         e.Body.LineNumber,
+				ColumnNumber:       e.Body.ColumnNumber,
+			})
+		}
+		return reports, nil
+	case "application/csp-report", "application/json":
+		var legacy legacyCSPReport
+		err := json.Unmarshal(b, &legacy)
+		if err != nil {
+			return nil, err
+		}
+
+		lr := legacy.Report
+		if lr.DocumentURI == "" {
+			return nil, errors.New("missing csp-report")
+		}
+
+		directive := lr.EffectiveDirective
+		if directive == "" {
+			directive = lr.ViolatedDirective
+		}
+
+		return []CSPReport{{
+			DocumentURI:        lr.DocumentURI,
+			Referrer:           lr.Referrer,
+			BlockedURI:         lr.BlockedURI,
+			EffectiveDirective: directive,
+			OriginalPolicy:     lr.OriginalPolicy,
+			Disposition:        lr.Disposition,
+			SourceFile:         lr.SourceFile,
+			Sample:             lr.ScriptSample,
+			StatusCode:         lr.StatusCode,
+			LineNumber:         lr.LineNumber,
+			ColumnNumber:       lr.ColumnNumber,
+		}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported report type %q", mediaType)
+}
@@ -0,0 +1,200 @@
+package autohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestContentSecurityPolicyString(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Policy *ContentSecurityPolicy
+		Nonce  string
+		Expect string
+	}{
+		{
+			"basic",
+			NewContentSecurityPolicy().DefaultSrc(CSPSelf).ImgSrc(CSPSelf, CSPData).ObjectSrc(CSPNone),
+			"",
+			"default-src 'self'; img-src 'self' data:; object-src 'none'",
+		},
+		{
+			"nonce",
+			NewContentSecurityPolicy().ScriptSrc(CSPNonce, CSPStrictDynamic),
+			"abc",
+			"script-src 'nonce-abc' 'strict-dynamic'",
+		},
+		{
+			"repeated-directive",
+			NewContentSecurityPolicy().ScriptSrc(CSPSelf).ScriptSrc(CSPHost("https://cdn.example.com"), CSPHash("sha256", "xyz")),
+			"",
+			"script-src 'self' https://cdn.example.com 'sha256-xyz'",
+		},
+		{
+			"flags-and-report",
+			NewContentSecurityPolicy().DefaultSrc(CSPSelf).UpgradeInsecureRequests().ReportURI("/csp"),
+			"",
+			"default-src 'self'; upgrade-insecure-requests; report-uri /csp; report-to csp-endpoint",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			got := c.Policy.String(c.Nonce)
+			if got != c.Expect {
+				t.Errorf("expected %q got %q", c.Expect, got)
+			}
+		})
+	}
+}
+
+func TestContentSecurityPolicyRouter(t *testing.T) {
+	assets := fstest.MapFS{
+		"dist/index.html": {Data: []byte("<html></html>")},
+	}
+
+	var reports []CSPReport
+	sink := CSPReportSinkFunc(func(r *http.Request, report CSPReport) {
+		reports = append(reports, report)
+	})
+
+	policy := NewContentSecurityPolicy().DefaultSrc(CSPSelf).ScriptSrc(CSPSelf, CSPNonce)
+	r, err := NewRouter(
+		lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)),
+		WithEmbeddedAssets(assets, "dist"),
+		WithContentSecurityPolicy(policy),
+		WithCSPReportRoute("/csp-report", sink),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/nonce", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(GetCSPNonce(req)))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/fn", func(ctx context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/fn-nonce", func(ctx context.Context) (string, error) {
+		return CSPNonceFromContext(ctx), nil
+	}, WithRouteEncoder(&TextEncoder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/fn-nonce", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if nonce := w.Body.String(); nonce == "" || !strings.Contains(w.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("expected the function to see the request's nonce, got %q", nonce)
+	}
+
+	var nonces []string
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/nonce", nil))
+
+		nonce := w.Body.String()
+		if nonce == "" {
+			t.Fatal("expected a nonce")
+		}
+
+		expect := "default-src 'self'; script-src 'self' 'nonce-" + nonce + "'; report-uri /csp-report; report-to csp-endpoint"
+		if got := w.Header().Get("Content-Security-Policy"); got != expect {
+			t.Errorf("expected %q got %q", expect, got)
+		}
+
+		if w.Header().Get("Reporting-Endpoints") != `csp-endpoint="/csp-report"` {
+			t.Errorf("unexpected Reporting-Endpoints %q", w.Header().Get("Reporting-Endpoints"))
+		}
+
+		nonces = append(nonces, nonce)
+	}
+
+	if nonces[0] == nonces[1] {
+		t.Error("expected a fresh nonce per request")
+	}
+
+	for _, path := range []string{"/index.html", "/missing"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if !strings.HasPrefix(w.Header().Get("Content-Security-Policy"), "default-src 'self'") {
+			t.Errorf("expected policy on asset %s", path)
+		}
+	}
+
+	reportCases := []struct {
+		Name         string
+		ContentType  string
+		Body         string
+		ExpectStatus int
+		ExpectBlock  string
+	}{
+		{
+			"legacy",
+			"application/csp-report",
+			`{"csp-report":{"document-uri":"https://example.com/","violated-directive":"script-src","blocked-uri":"https://evil.example.com/x.js"}}`,
+			http.StatusNoContent,
+			"https://evil.example.com/x.js",
+		},
+		{
+			"reporting-api",
+			"application/reports+json",
+			`[{"type":"csp-violation","body":{"documentURL":"https://example.com/","effectiveDirective":"img-src","blockedURL":"https://evil.example.com/x.png"}},{"type":"deprecation","body":{}}]`,
+			http.StatusNoContent,
+			"https://evil.example.com/x.png",
+		},
+		{"invalid", "application/csp-report", `{`, http.StatusBadRequest, ""},
+		{"unsupported", "text/plain", `hi`, http.StatusBadRequest, ""},
+	}
+
+	for _, c := range reportCases {
+		t.Run(c.Name, func(t *testing.T) {
+			reports = nil
+
+			req := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(c.Body))
+			req.Header.Set("Content-Type", c.ContentType)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != c.ExpectStatus {
+				t.Errorf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+
+			if c.ExpectBlock == "" {
+				if len(reports) != 0 {
+					t.Errorf("expected no reports got %v", reports)
+				}
+				return
+			}
+
+			if len(reports) != 1 || reports[0].BlockedURI != c.ExpectBlock || reports[0].EffectiveDirective == "" {
+				t.Errorf("unexpected reports %+v", reports)
+			}
+		})
+	}
+}
+
+func TestCSPReportRouteNeedsPolicy(t *testing.T) {
+	_, err := NewRouter(nil, WithCSPReportRoute("/csp-report", nil))
+	if err == nil {
+		t.Error("expected an error without a policy")
+	}
+}
@@ -0,0 +1,226 @@
+package autohttp
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	stringTableType   = reflect.TypeOf([][]string{})
+)
+
+// CSVEncoder writes a slice of structs as text/csv, with a header row named
+// by the `csv` struct tag or the field name. A [][]string is written as is
+type CSVEncoder struct{}
+
+func (ce *CSVEncoder) ValidateType(fn interface{}) error {
+	rt := encodableReturnType(fn)
+	if rt == nil || rt == stringTableType {
+		return nil
+	}
+
+	rowType, ok := csvRowType(rt)
+	if !ok {
+		return fmt.Errorf("csv encoder can only encode slices of structs, not %s", rt)
+	}
+
+	for _, f := range csvFields(rowType) {
+		ft := f.typ
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if !isCSVCell(ft) {
+			return fmt.Errorf("csv encoder cannot encode field %s of type %s", f.name, f.typ)
+		}
+	}
+
+	return nil
+}
+
+func (ce *CSVEncoder) MediaType() string {
+	return "text/csv"
+}
+
+func (ce *CSVEncoder) Encode(value interface{}, hw HeaderWriter) (int, io.Reader, error) {
+	hw("Content-Type", "text/csv; charset=utf-8")
+
+	var b bytes.Buffer
+	cw := csv.NewWriter(&b)
+
+	if table, ok := value.([][]string); ok {
+		err := cw.WriteAll(table)
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+
+		return http.StatusOK, &b, nil
+	}
+
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return http.StatusOK, &b, nil
+	}
+
+	rowType, ok := csvRowType(v.Type())
+	if !ok {
+		return http.StatusInternalServerError, nil, errors.New("csv encoder can only encode slices of structs")
+	}
+
+	// a nil pointer to a slice has no rows, but still gets a header
+	rows := 0
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Ptr {
+		rows = v.Len()
+	}
+
+	fields := csvFields(rowType)
+	header := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.name
+	}
+
+	err := cw.Write(header)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	for i := 0; i < rows; i++ {
+		row := v.Index(i)
+		for row.Kind() == reflect.Ptr {
+			row = row.Elem()
+		}
+
+		record := make([]string, len(fields))
+		if row.IsValid() {
+			for j, f := range fields {
+				record[j], err = csvCell(row.FieldByIndex(f.index))
+				if err != nil {
+					return http.StatusInternalServerError, nil, err
+				}
+			}
+		}
+
+		err = cw.Write(record)
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, &b, nil
+}
+
+// csvRowType returns the struct type of each row of t
+func csvRowType(t reflect.Type) (reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	row := t.Elem()
+	for row.Kind() == reflect.Ptr {
+		row = row.Elem()
+	}
+
+	return row, row.Kind() == reflect.Struct
+}
+
+type csvField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+func csvFields(t reflect.Type) []csvField {
+	var fields []csvField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name := sf.Tag.Get("csv")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, csvField{name: name, index: sf.Index, typ: sf.Type})
+	}
+
+	return fields
+}
+
+func isCSVCell(t reflect.Type) bool {
+	if t == timeType || t.Implements(textMarshalerType) || t.Implements(stringerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+func csvCell(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return x.Format(time.RFC3339), nil
+	case encoding.TextMarshaler:
+		b, err := x.MarshalText()
+		return string(b), err
+	case fmt.Stringer:
+		return x.String(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+
+	return "", fmt.Errorf("csv encoder cannot encode %s", v.Type())
+}
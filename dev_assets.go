@@ -0,0 +1,309 @@
+package autohttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+// WithDevProxy reverse proxies every request that misses a route to a
+// frontend dev server such as Vite, esbuild or webpack, including the
+// WebSocket upgrades they use for hot module reloading. It replaces
+// WithEmbeddedAssets during development
+func WithDevProxy(target string) func(r *Router) error {
+	return func(r *Router) error {
+		u, err := url.Parse(target)
+		if err != nil {
+			return err
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("dev proxy target %q must be an absolute url", target)
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		log := r.log
+		proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+			log.Errorf("dev proxy to %s failed: %s", target, err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+
+		r.devAssets = proxy
+		return nil
+	}
+}
+
+// DevBuild runs a frontend build in watch mode and serves its output from
+// disk, reloading open pages whenever the output changes
+type DevBuild struct {
+	// Command is the build command and its arguments, such as
+	// []string{"npx", "esbuild", "app.ts", "--bundle", "--outdir=dist", "--watch"}
+	Command []string
+	// Dir is the working directory of Command
+	Dir string
+	// OutputDir is the directory the build writes to, relative to Dir
+	OutputDir string
+	// PollInterval is how often OutputDir is checked for changes
+	PollInterval time.Duration
+}
+
+// liveReloadPath is the event stream pages served by a DevBuild listen on
+const liveReloadPath = "/_autohttp/livereload"
+
+const liveReloadScript = `new EventSource("` + liveReloadPath + `").onmessage = function () { location.reload() }`
+
+// liveReloadTag wraps the live reload script in a <script> tag, carrying
+// nonce so it runs under a Content-Security-Policy using CSPNonce
+func liveReloadTag(nonce string) string {
+	if nonce == "" {
+		return "<script>" + liveReloadScript + "</script>"
+	}
+	return `<script nonce="` + nonce + `">` + liveReloadScript + "</script>"
+}
+
+// WithDevBuild starts b.Command and serves b.OutputDir for every request
+// that misses a route, with live reload injected into HTML pages. Missing
+// files fall back to index.html, as with WithEmbeddedAssets. Call
+// Router.Close to stop the build
+func WithDevBuild(b DevBuild) func(r *Router) error {
+	return func(r *Router) error {
+		if len(b.Command) == 0 || b.OutputDir == "" {
+			return errors.New("dev build needs a command and an output directory")
+		}
+
+		if b.PollInterval <= 0 {
+			b.PollInterval = 250 * time.Millisecond
+		}
+
+		ds, err := startDevBuild(b, r.log)
+		if err != nil {
+			return err
+		}
+
+		r.devAssets = ds
+		r.closers = append(r.closers, ds.Close)
+		return nil
+	}
+}
+
+type devBuildServer struct {
+	build DevBuild
+	fsys  fs.FS
+	files http.Handler
+	log   lounge.Log
+
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func startDevBuild(b DevBuild, log lounge.Log) (*devBuildServer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cmd := exec.Command(b.Command[0], b.Command[1:]...)
+	cmd.Dir = b.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	setProcessGroup(cmd)
+
+	err := cmd.Start()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	outputDir := b.OutputDir
+	if !filepath.IsAbs(outputDir) && b.Dir != "" {
+		outputDir = filepath.Join(b.Dir, outputDir)
+	}
+
+	fsys := os.DirFS(outputDir)
+	ds := &devBuildServer{
+		build:   b,
+		fsys:    fsys,
+		files:   http.FileServer(http.FS(fsys)),
+		log:     log,
+		cmd:     cmd,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		clients: make(map[chan struct{}]bool),
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("dev build %q exited: %s", strings.Join(b.Command, " "), err)
+		}
+	}()
+
+	go ds.watch(ctx)
+
+	return ds, nil
+}
+
+// Close stops the build command, along with anything it started, and the
+// watcher
+func (ds *devBuildServer) Close() error {
+	ds.cancel()
+	err := killProcessGroup(ds.cmd)
+	<-ds.done
+	return err
+}
+
+// watch polls the output directory, notifying clients when it changes
+func (ds *devBuildServer) watch(ctx context.Context) {
+	defer close(ds.done)
+
+	ticker := time.NewTicker(ds.build.PollInterval)
+	defer ticker.Stop()
+
+	last := ds.fingerprint()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := ds.fingerprint()
+		if current == last {
+			continue
+		}
+		last = current
+
+		ds.mu.Lock()
+		for c := range ds.clients {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+		ds.mu.Unlock()
+	}
+}
+
+// fingerprint summarizes the names, sizes and modification times of
+// every file in the output directory
+func (ds *devBuildServer) fingerprint() string {
+	var b strings.Builder
+	fs.WalkDir(ds.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		fmt.Fprintf(&b, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+
+	return b.String()
+}
+
+func (ds *devBuildServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == liveReloadPath {
+		ds.serveEvents(w, req)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+
+	name := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	info, err := fs.Stat(ds.fsys, name)
+	switch {
+	case err != nil:
+		name = "index.html"
+	case info.IsDir():
+		name = path.Join(name, "index.html")
+	}
+
+	if !strings.HasSuffix(name, ".html") {
+		ds.files.ServeHTTP(w, req)
+		return
+	}
+
+	page, err := fs.ReadFile(ds.fsys, name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(injectLiveReload(page, GetCSPNonce(req)))
+}
+
+// injectLiveReload adds the live reload script before </body>, or at the
+// end of pages without one
+func injectLiveReload(page []byte, nonce string) []byte {
+	tag := liveReloadTag(nonce)
+
+	idx := bytes.LastIndex(bytes.ToLower(page), []byte("</body>"))
+	if idx == -1 {
+		return append(page, tag...)
+	}
+
+	out := make([]byte, 0, len(page)+len(tag))
+	out = append(out, page[:idx]...)
+	out = append(out, tag...)
+	return append(out, page[idx:]...)
+}
+
+func (ds *devBuildServer) serveEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	changed := make(chan struct{}, 1)
+	ds.mu.Lock()
+	ds.clients[changed] = true
+	ds.mu.Unlock()
+
+	defer func() {
+		ds.mu.Lock()
+		delete(ds.clients, changed)
+		ds.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ds.done:
+			return
+		case <-changed:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package autohttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestDevProxy(t *testing.T) {
+	devServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") == "websocket" {
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+
+			fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			rw.Flush()
+
+			// echo a single line back over the upgraded connection
+			line, _ := rw.ReadString('\n')
+			fmt.Fprint(rw, "echo: "+line)
+			rw.Flush()
+			return
+		}
+
+		fmt.Fprintf(w, "dev %s", req.URL.Path)
+	}))
+	defer devServer.Close()
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithDevProxy(devServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodGet, "/api/ping", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "pong")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cases := []struct {
+		Path   string
+		Expect string
+	}{
+		{"/api/ping", "pong"},
+		{"/src/main.ts", "dev /src/main.ts"},
+		{"/", "dev /"},
+	}
+
+	for _, c := range cases {
+		resp, err := http.Get(srv.URL + c.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != c.Expect {
+			t.Errorf("%s: expected %q got %q", c.Path, c.Expect, b)
+		}
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "GET /hmr HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101 got %d", resp.StatusCode)
+	}
+
+	fmt.Fprint(conn, "hello\n")
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "echo: hello\n" {
+		t.Errorf("unexpected echo %q", line)
+	}
+
+	_, err = NewRouter(nil, WithDevProxy("localhost:5173"))
+	if err == nil {
+		t.Error("expected a relative target to be rejected")
+	}
+}
+
+func TestDevBuild(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithDevBuild(DevBuild{
+		Command:      []string{"sh", "-c", `mkdir -p out && printf '<html><body>hi</body></html>' > out/index.html && printf 'js' > out/app.js && exec sleep 30`},
+		Dir:          dir,
+		OutputDir:    "out",
+		PollInterval: 10 * time.Millisecond,
+	}), WithContentSecurityPolicy(NewContentSecurityPolicy().ScriptSrc(CSPNonce)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	get := func(path string) (string, string) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), resp.Header.Get("Content-Security-Policy")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for body, _ := get("/app.js"); body != "js"; body, _ = get("/app.js") {
+		if time.Now().After(deadline) {
+			t.Fatal("build output never appeared")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, path := range []string{"/", "/some/client/route"} {
+		page, policy := get(path)
+		nonce := strings.TrimSuffix(strings.TrimPrefix(policy, "script-src 'nonce-"), "'")
+		if nonce == "" || !strings.Contains(page, `hi<script nonce="`+nonce+`">`+liveReloadScript+"</script></body>") {
+			t.Errorf("%s: expected live reload script with nonce from %q in %q", path, policy, page)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+liveReloadPath, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// give the watcher a tick to see the subscription before changing files
+	time.Sleep(50 * time.Millisecond)
+	err = os.WriteFile(filepath.Join(dir, "out", "app.js"), []byte("changed"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "data: reload\n" {
+		t.Errorf("unexpected event %q", line)
+	}
+}
+
+func TestDevBuildStoppedWhenRouterFails(t *testing.T) {
+	dir := t.TempDir()
+	tick := filepath.Join(dir, "tick")
+
+	// a later option fails once the build's background loop is running
+	failing := func(r *Router) error {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if _, err := os.Stat(tick); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return errors.New("later option failed")
+	}
+
+	// the loop is a grandchild, as the processes npx starts would be
+	_, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithDevBuild(DevBuild{
+		Command:   []string{"sh", "-c", `(while true; do touch tick; sleep 0.02; done) & exec sleep 30`},
+		Dir:       dir,
+		OutputDir: ".",
+	}), failing)
+	if err == nil {
+		t.Fatal("expected the failing option's error")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	os.Remove(tick)
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := os.Stat(tick); err == nil {
+		t.Error("expected the build and everything it started to be stopped")
+	}
+}
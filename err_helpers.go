@@ -2,7 +2,9 @@ package autohttp
 
 import (
 	"errors"
+	"net/http"
 	"reflect"
+	"strings"
 )
 
 var ErrDuplicateType = errors.New("httpz: duplicate type in input args")
@@ -26,3 +28,51 @@ func NewErrorWithCode(err error, code int) error {
 func (ewc ErrorWithCode) Error() string {
 	return ewc.Err.Error()
 }
+
+func (ewc ErrorWithCode) Unwrap() error {
+	return ewc.Err
+}
+
+// statusCodeFor returns the status code carried by err, or 500
+func statusCodeFor(err error) int {
+	var p *Problem
+	if errors.As(err, &p) && p.Status != 0 {
+		return p.Status
+	}
+
+	var mwe MiddlewareError
+	if errors.As(err, &mwe) {
+		return mwe.StatusCode
+	}
+
+	var ewc ErrorWithCode
+	if errors.As(err, &ewc) {
+		return ewc.StatusCode
+	}
+
+	var ewcPtr *ErrorWithCode
+	if errors.As(err, &ewcPtr) {
+		return ewcPtr.StatusCode
+	}
+
+	return http.StatusInternalServerError
+}
+
+// A FieldError describes a problem with a single input field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is returned (wrapped in an ErrorWithCode) when one or more
+// input fields could not be decoded
+type FieldErrors []FieldError
+
+func (fe FieldErrors) Error() string {
+	msgs := make([]string, len(fe))
+	for i, e := range fe {
+		msgs[i] = e.Field + ": " + e.Message
+	}
+
+	return strings.Join(msgs, "; ")
+}
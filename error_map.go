@@ -0,0 +1,93 @@
+package autohttp
+
+import (
+	"errors"
+	"reflect"
+)
+
+// An ErrorMap translates domain errors into status codes, so functions can
+// return their own errors without wrapping each one in an ErrorWithCode.
+//
+// Mappings are checked in the order they were added. An error that already
+// carries a status code, such as an ErrorWithCode, is never remapped
+type ErrorMap struct {
+	mappings []errorMapping
+}
+
+type errorMapping struct {
+	matches    func(err error) bool
+	statusCode int
+}
+
+func NewErrorMap() *ErrorMap {
+	return &ErrorMap{}
+}
+
+// Is maps any error matching target with errors.Is to statusCode
+func (em *ErrorMap) Is(target error, statusCode int) *ErrorMap {
+	em.mappings = append(em.mappings, errorMapping{
+		matches: func(err error) bool {
+			return errors.Is(err, target)
+		},
+		statusCode: statusCode,
+	})
+
+	return em
+}
+
+// As maps any error matching the type of target with errors.As to statusCode.
+// target is any value of the error type, for example (*NotFoundError)(nil)
+func (em *ErrorMap) As(target error, statusCode int) *ErrorMap {
+	targetType := reflect.TypeOf(target)
+	if targetType == nil {
+		panic("autohttp: ErrorMap.As target must be a typed error")
+	}
+
+	em.mappings = append(em.mappings, errorMapping{
+		matches: func(err error) bool {
+			return errors.As(err, reflect.New(targetType).Interface())
+		},
+		statusCode: statusCode,
+	})
+
+	return em
+}
+
+// StatusCode returns the status code mapped to err, if there is one
+func (em *ErrorMap) StatusCode(err error) (int, bool) {
+	if em == nil {
+		return 0, false
+	}
+
+	for _, m := range em.mappings {
+		if m.matches(err) {
+			return m.statusCode, true
+		}
+	}
+
+	return 0, false
+}
+
+// hasStatusCode reports whether err already carries a status code
+func hasStatusCode(err error) bool {
+	var ewc ErrorWithCode
+	var ewcPtr *ErrorWithCode
+	var mwe MiddlewareError
+	var p *Problem
+
+	return errors.As(err, &ewc) || errors.As(err, &ewcPtr) || errors.As(err, &mwe) || errors.As(err, &p)
+}
+
+// apply wraps err with its mapped status code
+func (em *ErrorMap) apply(err error) error {
+	if em == nil || hasStatusCode(err) {
+		return err
+	}
+
+	code, ok := em.StatusCode(err)
+	if !ok {
+		return err
+	}
+
+	return ErrorWithCode{Err: err, StatusCode: code}
+}
@@ -0,0 +1,122 @@
+package autohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+var errNotFound = errors.New("not found")
+
+type conflictError struct {
+	Resource string
+}
+
+func (ce *conflictError) Error() string {
+	return ce.Resource + " already exists"
+}
+
+func TestErrorMap(t *testing.T) {
+	t.Parallel()
+
+	em := NewErrorMap().
+		Is(errNotFound, http.StatusNotFound).
+		As((*conflictError)(nil), http.StatusConflict)
+
+	cases := []struct {
+		Name       string
+		Err        error
+		ExpectCode int
+	}{
+		{"is", errNotFound, http.StatusNotFound},
+		{"is-wrapped", fmt.Errorf("loading user: %w", errNotFound), http.StatusNotFound},
+		{"as", &conflictError{Resource: "user"}, http.StatusConflict},
+		{"as-wrapped", fmt.Errorf("creating: %w", &conflictError{Resource: "user"}), http.StatusConflict},
+		{"unmapped", errors.New("boom"), http.StatusInternalServerError},
+		{"explicit-code-wins", ErrorWithCode{Err: errNotFound, StatusCode: http.StatusGone}, http.StatusGone},
+		{"explicit-pointer-code-wins", NewErrorWithCode(errNotFound, http.StatusGone), http.StatusGone},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			code := statusCodeFor(em.apply(c.Err))
+			if code != c.ExpectCode {
+				t.Errorf("expected %d got %d", c.ExpectCode, code)
+			}
+		})
+	}
+}
+
+func TestRouterErrorHandlers(t *testing.T) {
+	var handledBy string
+	errorHandler := func(name string) ErrorHandler {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			handledBy = name
+			DefaultErrorHandler(w, r, err)
+		}
+	}
+
+	r, err := NewRouter(
+		lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)),
+		WithDefaultErrorHandler(errorHandler("router")),
+		WithErrorMap(NewErrorMap().Is(errNotFound, http.StatusNotFound)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := func(ctx context.Context) error {
+		return fmt.Errorf("lookup: %w", errNotFound)
+	}
+
+	err = r.Register(http.MethodPost, "/default", failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/override", failing, WithRouteErrorHandler(errorHandler("route")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/raw", http.NotFoundHandler(), WithRouteMiddleware(rejectingMiddleware{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Path          string
+		ExpectHandler string
+		ExpectStatus  int
+	}{
+		{"/default", "router", http.StatusNotFound},
+		{"/override", "route", http.StatusNotFound},
+		{"/raw", "router", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Path, func(t *testing.T) {
+			handledBy = ""
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, c.Path, strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if handledBy != c.ExpectHandler {
+				t.Errorf("expected error handler %q got %q", c.ExpectHandler, handledBy)
+			}
+
+			if w.Code != c.ExpectStatus {
+				t.Errorf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package autohttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+const maxFormDecoderInputArgs = 4
+
+var (
+	// 32MB
+	DefaultMaxFormBytesToRead int64 = 32 << 20
+	// 10MB
+	DefaultMaxFileBytes int64 = 10 << 20
+	// 8MB
+	DefaultMaxFormMemory int64 = 8 << 20
+)
+
+var (
+	formFileType      = reflect.TypeOf(&FormFile{})
+	formFileSliceType = reflect.TypeOf([]*FormFile{})
+)
+
+// A FormFile is a file uploaded as part of a multipart/form-data request.
+// Struct fields of type *FormFile or []*FormFile are filled by the FormDecoder
+type FormFile struct {
+	Filename    string
+	Size        int64
+	ContentType string
+
+	fh *multipart.FileHeader
+}
+
+// Open returns the contents of the uploaded file. The file is removed
+// once the request has been served
+func (ff *FormFile) Open() (multipart.File, error) {
+	return ff.fh.Open()
+}
+
+// FormDecoder fills the struct argument of a function from an
+// application/x-www-form-urlencoded or multipart/form-data body.
+//
+// Fields are matched using the `form` struct tag, falling back to the field
+// name, following the same rules as the QueryDecoder
+type FormDecoder struct {
+	// MaxBytesToRead limits the size of the entire request body
+	MaxBytesToRead int64
+	// MaxFileBytes limits the size of each uploaded file
+	MaxFileBytes int64
+	// MaxMemory is how much of a multipart body is held in memory,
+	// the rest is stored in temporary files
+	MaxMemory int64
+
+	DisallowUnknownFields bool
+}
+
+func NewFormDecoder() *FormDecoder {
+	return &FormDecoder{
+		MaxBytesToRead:        DefaultMaxFormBytesToRead,
+		MaxFileBytes:          DefaultMaxFileBytes,
+		MaxMemory:             DefaultMaxFormMemory,
+		DisallowUnknownFields: true,
+	}
+}
+
+func (fd *FormDecoder) ValidateType(fn interface{}) error {
+	ia, err := fd.inputsAtIndices(fn)
+	if err != nil {
+		return err
+	}
+
+	if ia.decodeIdx != uIdx {
+		_, err = compileValuesStruct(reflect.ValueOf(fn).Type().In(ia.decodeIdx), "form")
+		return err
+	}
+
+	return nil
+}
+
+func (fd *FormDecoder) inputsAtIndices(fn interface{}) (inputArgs, error) {
+	return findInputArgs(fn, maxFormDecoderInputArgs, isValuesDecodable)
+}
+
+var errBodyTooLarge = errors.New("autohttp: request body too large")
+
+// limitedBody is an io.Reader that fails once more than n bytes are read
+type limitedBody struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.n <= 0 {
+		lb.exceeded = true
+		return 0, errBodyTooLarge
+	}
+
+	if int64(len(p)) > lb.n {
+		p = p[:lb.n+1]
+	}
+
+	n, err := lb.r.Read(p)
+	lb.n -= int64(n)
+	if lb.n < 0 {
+		lb.exceeded = true
+		return n, errBodyTooLarge
+	}
+
+	return n, err
+}
+
+// Decode returns the reflect values needed to call the fn
+// from the *http.Request
+func (fd *FormDecoder) Decode(fn interface{}, r *http.Request) ([]reflect.Value, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data") {
+		return nil, ErrorWithCode{Err: errors.New("invalid mime type"), StatusCode: http.StatusUnsupportedMediaType}
+	}
+
+	ia, err := fd.inputsAtIndices(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	callValues := ia.injectedValues(fn, r)
+	if ia.decodeIdx == uIdx {
+		return callValues, nil
+	}
+
+	inArg := reflect.ValueOf(fn).Type().In(ia.decodeIdx)
+	vs, err := compileValuesStruct(inArg, "form")
+	if err != nil {
+		return nil, err
+	}
+
+	body := &limitedBody{r: r.Body, n: fd.MaxBytesToRead}
+
+	var values url.Values
+	var files map[string][]*multipart.FileHeader
+	if mediaType == "multipart/form-data" {
+		r.Body = io.NopCloser(body)
+		err = r.ParseMultipartForm(fd.MaxMemory)
+		if err == nil {
+			values, files = r.MultipartForm.Value, r.MultipartForm.File
+		}
+	} else {
+		var raw []byte
+		raw, err = io.ReadAll(body)
+		if err == nil {
+			values, err = url.ParseQuery(string(raw))
+		}
+	}
+
+	if body.exceeded {
+		return nil, ErrorWithCode{Err: fmt.Errorf("maximum body size exceeded (%d bytes)", fd.MaxBytesToRead), StatusCode: http.StatusRequestEntityTooLarge}
+	}
+
+	if err != nil {
+		return nil, ErrorWithCode{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	object := newDecodeTarget(inArg)
+	err = vs.decode(object.Elem(), values, fd.DisallowUnknownFields)
+	if err != nil {
+		return nil, ErrorWithCode{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	err = fd.decodeFiles(vs, object.Elem(), files)
+	if err != nil {
+		return nil, err
+	}
+
+	callValues[ia.decodeIdx] = decodeTargetValue(inArg, object)
+
+	return callValues, nil
+}
+
+func (fd *FormDecoder) decodeFiles(vs *valuesStruct, target reflect.Value, files map[string][]*multipart.FileHeader) error {
+	var fieldErrs FieldErrors
+
+	if fd.DisallowUnknownFields {
+		for k := range files {
+			if !vs.keys[k] {
+				fieldErrs = append(fieldErrs, FieldError{Field: k, Message: "unknown field"})
+			}
+		}
+	}
+
+	for _, f := range vs.files {
+		headers := files[f.key]
+		if len(headers) == 0 {
+			continue
+		}
+
+		formFiles := make([]*FormFile, 0, len(headers))
+		for _, fh := range headers {
+			if fh.Size > fd.MaxFileBytes {
+				return ErrorWithCode{
+					Err:        FieldErrors{{Field: f.key, Message: fmt.Sprintf("file exceeds maximum size (%d bytes)", fd.MaxFileBytes)}},
+					StatusCode: http.StatusRequestEntityTooLarge,
+				}
+			}
+
+			formFiles = append(formFiles, &FormFile{
+				Filename:    fh.Filename,
+				Size:        fh.Size,
+				ContentType: fh.Header.Get("Content-Type"),
+				fh:          fh,
+			})
+		}
+
+		if f.typ == formFileType {
+			target.FieldByIndex(f.index).Set(reflect.ValueOf(formFiles[0]))
+		} else {
+			target.FieldByIndex(f.index).Set(reflect.ValueOf(formFiles))
+		}
+	}
+
+	if len(fieldErrs) > 0 {
+		return ErrorWithCode{Err: fieldErrs, StatusCode: http.StatusBadRequest}
+	}
+
+	return nil
+}
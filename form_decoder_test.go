@@ -0,0 +1,159 @@
+package autohttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+type formUpload struct {
+	Title       string      `form:"title"`
+	Count       *int        `form:"count"`
+	Avatar      *FormFile   `form:"avatar"`
+	Attachments []*FormFile `form:"attachments"`
+}
+
+func newMultipartBody(t *testing.T, fields map[string]string, files map[string]string) (io.Reader, string) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+
+	for k, contents := range files {
+		fw, err := mw.CreateFormFile(k, k+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(contents))
+	}
+
+	mw.Close()
+	return &b, mw.FormDataContentType()
+}
+
+func TestFormDecoderValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name      string
+		Decoder   Decoder
+		Fn        interface{}
+		ShouldErr bool
+	}{
+		{"form-files", NewFormDecoder(), func(ctx context.Context, in formUpload) {}, false},
+		{"form-map", NewFormDecoder(), func(in struct{ M map[string]int }) {}, true},
+		{"query-files", NewQueryDecoder(), func(ctx context.Context, in formUpload) {}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := c.Decoder.ValidateType(c.Fn)
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
+
+func TestFormDecoder(t *testing.T) {
+	var got formUpload
+	var avatarContents string
+	fn := func(ctx context.Context, in formUpload) {
+		got = in
+		if in.Avatar != nil {
+			f, err := in.Avatar.Open()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+
+			b, err := io.ReadAll(f)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			avatarContents = string(b)
+		}
+	}
+
+	multipartBody, multipartType := newMultipartBody(t, map[string]string{"title": "hello", "count": "3"}, map[string]string{"avatar": "avatar-bytes", "attachments": "a"})
+	bigFileBody, bigFileType := newMultipartBody(t, nil, map[string]string{"avatar": strings.Repeat("A", 2048)})
+	unknownBody, unknownType := newMultipartBody(t, nil, map[string]string{"other": "x"})
+
+	cases := []struct {
+		Name         string
+		Body         io.Reader
+		ContentType  string
+		ExpectStatus int
+		ExpectTitle  string
+		ExpectAvatar string
+	}{
+		{"urlencoded", strings.NewReader("title=hi&count=2"), "application/x-www-form-urlencoded", http.StatusNoContent, "hi", ""},
+		{"urlencoded-charset", strings.NewReader("title=hi"), "application/x-www-form-urlencoded; charset=utf-8", http.StatusNoContent, "hi", ""},
+		{"urlencoded-bad-int", strings.NewReader("count=x"), "application/x-www-form-urlencoded", http.StatusBadRequest, "", ""},
+		{"urlencoded-unknown", strings.NewReader("nope=x"), "application/x-www-form-urlencoded", http.StatusBadRequest, "", ""},
+		{"urlencoded-too-large", strings.NewReader("title=" + strings.Repeat("A", 8192)), "application/x-www-form-urlencoded", http.StatusRequestEntityTooLarge, "", ""},
+		{"multipart", multipartBody, multipartType, http.StatusNoContent, "hello", "avatar-bytes"},
+		{"multipart-file-too-large", bigFileBody, bigFileType, http.StatusRequestEntityTooLarge, "", ""},
+		{"multipart-unknown-file", unknownBody, unknownType, http.StatusBadRequest, "", ""},
+		{"json", strings.NewReader(`{}`), "application/json", http.StatusUnsupportedMediaType, "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			got = formUpload{}
+			avatarContents = ""
+
+			fd := NewFormDecoder()
+			fd.MaxBytesToRead = 4096
+			fd.MaxFileBytes = 1024
+
+			ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), fd, NoOpEncoder{}, DefaultErrorHandler, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", c.Body)
+			r.Header.Set("Content-Type", c.ContentType)
+
+			ar.ServeHTTP(w, r)
+
+			if w.Code != c.ExpectStatus {
+				t.Fatalf("expected %d got %d: %s", c.ExpectStatus, w.Code, w.Body.String())
+			}
+
+			if got.Title != c.ExpectTitle {
+				t.Errorf("expected title %q got %q", c.ExpectTitle, got.Title)
+			}
+
+			if avatarContents != c.ExpectAvatar {
+				t.Errorf("expected avatar %q got %q", c.ExpectAvatar, avatarContents)
+			}
+
+			if c.Name == "multipart" {
+				if got.Avatar.Filename != "avatar.txt" || got.Avatar.Size != int64(len("avatar-bytes")) {
+					t.Errorf("unexpected avatar metadata %+v", got.Avatar)
+				}
+
+				if len(got.Attachments) != 1 || *got.Count != 3 {
+					t.Errorf("unexpected upload %+v", got)
+				}
+			}
+		})
+	}
+}
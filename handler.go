@@ -1,12 +1,14 @@
 package autohttp
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"reflect"
+	"time"
 
 	"github.com/fortytw2/lounge"
 )
@@ -37,22 +39,30 @@ type Encoder interface {
 	Encode(values interface{}, hw HeaderWriter) (int, io.Reader, error)
 }
 
-type ErrorHandler func(w http.ResponseWriter, err error)
+// An ErrorHandler writes err as the response to r
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
 
-func DefaultErrorHandler(w http.ResponseWriter, err error) {
-	ewc, ok := err.(ErrorWithCode)
-	if ok {
-		w.WriteHeader(ewc.StatusCode)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": err.Error(),
-		})
+// AdaptErrorHandler wraps an error handler written before ErrorHandler
+// was given the *http.Request
+func AdaptErrorHandler(fn func(w http.ResponseWriter, err error)) ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		fn(w, err)
+	}
+}
 
-		return
+// DefaultErrorHandler writes err as {"error": "..."}. The message of a 5xx
+// error is replaced with its status text so internal errors are not leaked
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := statusCodeFor(err)
+	message := errorDetail(err, status, false)
+	if message == "" {
+		message = http.StatusText(status)
 	}
 
-	w.WriteHeader(http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]string{
-		"error": err.Error(),
+		"error": message,
 	})
 }
 
@@ -64,7 +74,14 @@ type Handler struct {
 	encoder      Encoder
 	decoder      Decoder
 	errorHandler ErrorHandler
+	errorMap     *ErrorMap
 
+	middleware []Middleware
+	panicHook  PanicHook
+	validators map[int]*structValidator
+
+	// name identifies the route to introspectors such as OpenAPI
+	name                  string
 	hideFromIntrospectors bool
 }
 
@@ -94,54 +111,198 @@ func NewHandler(
 		return nil, errors.New("a function can only have up to 2 return values")
 	}
 
+	validators, err := compileInputValidators(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		log = lounge.NewDefaultLog()
+	}
+
+	if errorHandler == nil {
+		errorHandler = DefaultErrorHandler
+	}
+
 	return &Handler{
 		fn:                    fn,
+		log:                   log,
 		encoder:               encoder,
 		decoder:               decoder,
-		errorHandler:          DefaultErrorHandler,
+		errorHandler:          errorHandler,
+		validators:            validators,
 		hideFromIntrospectors: false,
 	}, nil
 }
 
+// compileInputValidators compiles the validation rules of every decoded
+// argument of fn, keyed by argument index
+func compileInputValidators(fn interface{}) (map[int]*structValidator, error) {
+	fnType := reflect.ValueOf(fn).Type()
+
+	validators := make(map[int]*structValidator)
+	for i := 0; i < fnType.NumIn(); i++ {
+		in := fnType.In(i)
+		if isContextType(in) || isHeaderType(in) || isPathParamsType(in) {
+			continue
+		}
+
+		sv, err := compileValidator(in)
+		if err != nil {
+			return nil, fmt.Errorf("validating argument %d: %w", i, err)
+		}
+
+		if sv != nil {
+			validators[i] = sv
+		}
+	}
+
+	return validators, nil
+}
+
+// handleError maps err through the Handler's ErrorMap and hands it to the
+// ErrorHandler
+func (h *Handler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	h.errorHandler(w, r, h.errorMap.apply(err))
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// remove any temporary files left behind by multipart forms
+	defer func() {
+		if r.MultipartForm != nil {
+			r.MultipartForm.RemoveAll()
+		}
+	}()
+
 	// handle panics
+	w, wrote := trackWrites(w)
 	defer func() {
-		if r := recover(); r != nil {
-			fmt.Fprintf(w, "panic in route execution: %v", r)
+		if rec := recover(); rec != nil {
+			handlePanic(w, r, rec, *wrote, h.log, h.panicHook, h.errorHandler)
 		}
 	}()
 
-	callValues, err := h.decoder.Decode(h.fn, r)
+	// time and trace each phase when the Router is instrumented
+	rm := getRouteMetrics(r)
+	span := SpanFromContext(r.Context())
+	mark := time.Now()
+
+	decodeSpan := span.startChild("decode")
+	callValues, err := h.prepareCall(r)
+	decodeSpan.finish(err)
+	mark = rm.record(phaseDecode, mark)
 	if err != nil {
-		// encode the parsing error cleanly
-		h.errorHandler(w, err)
+		h.handleError(w, r, err)
+		rm.record(phaseEncode, mark)
 		return
 	}
 
-	// call the handler function using reflection
+	callSpan := span.startChild("call")
+	value, err := h.call(h.withSpan(callValues, callSpan))
+	callSpan.finish(err)
+	mark = rm.record(phaseHandler, mark)
+	if err != nil {
+		h.handleError(w, r, err)
+		rm.record(phaseEncode, mark)
+		return
+	}
+
+	encodeSpan := span.startChild("encode")
+	h.writeValue(w, r, value)
+	encodeSpan.End()
+	rm.record(phaseEncode, mark)
+}
+
+// withSpan replaces the context.Context passed to the function with one
+// holding s, so spans started by the function nest below the call
+func (h *Handler) withSpan(callValues []reflect.Value, s *Span) []reflect.Value {
+	if s == nil || len(callValues) == 0 || !isContextType(reflect.TypeOf(h.fn).In(0)) {
+		return callValues
+	}
+
+	ctx := callValues[0].Interface().(context.Context)
+	callValues[0] = reflect.ValueOf(contextWithSpan(ctx, s))
+	return callValues
+}
+
+// prepareCall runs middleware, then decodes and validates the arguments
+// of the function from r
+func (h *Handler) prepareCall(r *http.Request) ([]reflect.Value, error) {
+	for _, mw := range h.middleware {
+		err := mw.Before(r, h)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	callValues, err := h.decoder.Decode(h.fn, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, sv := range h.validators {
+		if !callValues[idx].IsValid() {
+			continue
+		}
+
+		err = sv.validate(callValues[idx])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return callValues, nil
+}
+
+// call invokes the function using reflection, splitting out the error
+// from the value to encode
+func (h *Handler) call(callValues []reflect.Value) (interface{}, error) {
 	returnValues := reflect.ValueOf(h.fn).Call(callValues)
 
-	// split out the error value and the return value
 	var encodableValue interface{} = nil
 	for _, rv := range returnValues {
 		if isErrorType(rv.Type()) && !rv.IsNil() && !rv.IsZero() {
-			err = rv.Interface().(error)
-			// encode the parsing error cleanly
-			h.errorHandler(w, err)
-			return
+			return nil, rv.Interface().(error)
 		} else if !isErrorType(rv.Type()) {
 			encodableValue = rv.Interface()
 		}
 	}
 
-	responseCode, body, err := h.encoder.Encode(encodableValue, w.Header().Set)
-	if err != nil {
-		h.errorHandler(w, err)
+	return encodableValue, nil
+}
+
+// writeValue encodes a value returned by the function as the response
+func (h *Handler) writeValue(w http.ResponseWriter, r *http.Request, encodableValue interface{}) {
+	// let the function choose its own status code and headers
+	meta := unwrapResponse(encodableValue)
+	if !meta.hasBody {
+		w.WriteHeader(meta.apply(w, http.StatusNoContent))
+		return
+	}
+
+	var (
+		responseCode int
+		body         io.Reader
+		err          error
+	)
+	if re, ok := h.encoder.(RequestEncoder); ok {
+		responseCode, body, err = re.EncodeRequest(r, meta.body, w.Header().Set)
 	} else {
-		w.WriteHeader(responseCode)
-		_, err = io.Copy(w, body)
-		if err != nil {
-			h.log.Errorf("error copying response body to writer: %s", err)
-		}
+		responseCode, body, err = h.encoder.Encode(meta.body, w.Header().Set)
+	}
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	responseCode = meta.apply(w, responseCode)
+	w.WriteHeader(responseCode)
+	if body == nil || !bodyAllowedForStatus(responseCode) {
+		return
+	}
+
+	_, err = io.Copy(w, body)
+	if err != nil {
+		h.log.Errorf("error copying response body to writer: %s", err)
 	}
 }
@@ -51,7 +51,18 @@ func TestHandler(t *testing.T) {
 			},
 			strings.NewReader(`{"Name": "nah"}`),
 			http.StatusInternalServerError,
-			`{"error":"illegal"}`,
+			`{"error":"Internal Server Error"}`,
+		},
+		{
+			"client-error",
+			func(ctx context.Context, input struct {
+				Name string
+			}) error {
+				return NewErrorWithCode(errors.New("name is taken"), http.StatusConflict)
+			},
+			strings.NewReader(`{"Name": "nah"}`),
+			http.StatusConflict,
+			`{"error":"name is taken"}`,
 		},
 		{
 			"only-struct",
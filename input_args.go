@@ -0,0 +1,109 @@
+package autohttp
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// inputArgs records where each kind of argument sits in a handler function
+type inputArgs struct {
+	ctxIdx    int
+	headerIdx int
+	paramsIdx int
+	decodeIdx int
+}
+
+// findInputArgs validates the arguments of fn, returning the index of each
+// injectable argument and of the single argument the decoder fills in
+func findInputArgs(fn interface{}, maxArgs int, isDecodable func(t reflect.Type) bool) (inputArgs, error) {
+	ia := inputArgs{ctxIdx: uIdx, headerIdx: uIdx, paramsIdx: uIdx, decodeIdx: uIdx}
+
+	reflectFn := reflect.ValueOf(fn)
+	if reflectFn.Kind() != reflect.Func {
+		return ia, errors.New("handler must be a function")
+	}
+
+	inputArgCount := reflectFn.Type().NumIn()
+	if inputArgCount > maxArgs {
+		return ia, ErrTooManyInputArgs
+	}
+
+	var totalFound int
+	for i := 0; i < inputArgCount; i++ {
+		typeAtInputIdx := reflectFn.Type().In(i)
+
+		switch {
+		case isContextType(typeAtInputIdx):
+			if ia.ctxIdx != uIdx {
+				return ia, ErrDuplicateType
+			}
+
+			if i != 0 {
+				return ia, errTypeInvalidAtIndex(i, typeAtInputIdx)
+			}
+
+			ia.ctxIdx = i
+		case isHeaderType(typeAtInputIdx):
+			if ia.headerIdx != uIdx {
+				return ia, ErrDuplicateType
+			}
+
+			// header info is only valid as the first or second argument
+			if !(i == 0 || i == 1) {
+				return ia, errTypeInvalidAtIndex(i, typeAtInputIdx)
+			}
+
+			ia.headerIdx = i
+		case isPathParamsType(typeAtInputIdx):
+			if ia.paramsIdx != uIdx {
+				return ia, ErrDuplicateType
+			}
+
+			ia.paramsIdx = i
+		case isDecodable(typeAtInputIdx):
+			if ia.decodeIdx != uIdx {
+				return ia, ErrDuplicateType
+			}
+
+			ia.decodeIdx = i
+		default:
+			continue
+		}
+
+		totalFound++
+	}
+
+	if totalFound != inputArgCount {
+		return ia, errors.New("invalid arguments found")
+	}
+
+	return ia, nil
+}
+
+// injectedValues returns the call values for fn with every injectable
+// argument filled in from r. The decode target is left for the decoder
+func (ia inputArgs) injectedValues(fn interface{}, r *http.Request) []reflect.Value {
+	callValues := make([]reflect.Value, reflect.ValueOf(fn).Type().NumIn())
+
+	if ia.ctxIdx != uIdx {
+		callValues[ia.ctxIdx] = reflect.ValueOf(r.Context())
+	}
+
+	// add the httpz.Header to the call args
+	if ia.headerIdx != uIdx {
+		header := make(Header)
+		for k := range r.Header {
+			hVal := r.Header.Get(k)
+			header[http.CanonicalHeaderKey(k)] = hVal
+		}
+
+		callValues[ia.headerIdx] = reflect.ValueOf(header)
+	}
+
+	if ia.paramsIdx != uIdx {
+		callValues[ia.paramsIdx] = reflect.ValueOf(GetPathParams(r))
+	}
+
+	return callValues
+}
@@ -0,0 +1,542 @@
+package msgpack
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// ErrUnexpectedEnd is returned when data ends part way through a value
+var ErrUnexpectedEnd = errors.New("msgpack: unexpected end of input")
+
+// Unmarshal decodes the MessagePack data into v, which must be a non-nil pointer.
+// Map keys are matched to struct fields using the same names as Marshal,
+// falling back to a case-insensitive match
+func Unmarshal(data []byte, v interface{}) error {
+	return UnmarshalOptions{}.Unmarshal(data, v)
+}
+
+// UnmarshalOptions configures how data is decoded
+type UnmarshalOptions struct {
+	// DisallowUnknownFields causes an error when a map key does not
+	// match any field of the target struct
+	DisallowUnknownFields bool
+}
+
+func (uo UnmarshalOptions) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("msgpack: Unmarshal requires a non-nil pointer")
+	}
+
+	d := &decoder{data: data, opts: uo}
+	err := d.decode(rv.Elem())
+	if err != nil {
+		return err
+	}
+
+	if d.pos != len(d.data) {
+		return errors.New("msgpack: trailing data after value")
+	}
+
+	return nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+	opts UnmarshalOptions
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, ErrUnexpectedEnd
+	}
+
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readUint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+
+	var padded [8]byte
+	copy(padded[8-size:], b)
+	return binary.BigEndian.Uint64(padded[:]), nil
+}
+
+// kind identifies the family of the next value in the stream
+type kind int
+
+const (
+	kindNil kind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindString
+	kindBinary
+	kindArray
+	kindMap
+)
+
+// header reads the type byte of the next value along with its length (for
+// strings, binaries, arrays and maps) or its scalar payload
+type header struct {
+	kind kind
+	n    int
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+}
+
+func (d *decoder) readHeader() (header, error) {
+	tb, err := d.next(1)
+	if err != nil {
+		return header{}, err
+	}
+
+	t := tb[0]
+	switch {
+	case t <= 0x7f:
+		return header{kind: kindUint, u: uint64(t)}, nil
+	case t >= 0xe0:
+		return header{kind: kindInt, i: int64(int8(t))}, nil
+	case t&0xe0 == 0xa0:
+		return header{kind: kindString, n: int(t & 0x1f)}, nil
+	case t&0xf0 == 0x90:
+		return header{kind: kindArray, n: int(t & 0x0f)}, nil
+	case t&0xf0 == 0x80:
+		return header{kind: kindMap, n: int(t & 0x0f)}, nil
+	}
+
+	sized := func(k kind, size int) (header, error) {
+		n, err := d.readUint(size)
+		if err != nil {
+			return header{}, err
+		}
+
+		if n > uint64(len(d.data)) {
+			return header{}, ErrUnexpectedEnd
+		}
+
+		return header{kind: k, n: int(n)}, nil
+	}
+
+	switch t {
+	case 0xc0:
+		return header{kind: kindNil}, nil
+	case 0xc2, 0xc3:
+		return header{kind: kindBool, b: t == 0xc3}, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.readUint(1 << (t - 0xcc))
+		return header{kind: kindUint, u: u}, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		u, err := d.readUint(size)
+		// sign extend
+		shift := uint(64 - size*8)
+		return header{kind: kindInt, i: int64(u<<shift) >> shift}, err
+	case 0xca:
+		u, err := d.readUint(4)
+		return header{kind: kindFloat, f: float64(math.Float32frombits(uint32(u)))}, err
+	case 0xcb:
+		u, err := d.readUint(8)
+		return header{kind: kindFloat, f: math.Float64frombits(u)}, err
+	case 0xd9:
+		return sized(kindString, 1)
+	case 0xda:
+		return sized(kindString, 2)
+	case 0xdb:
+		return sized(kindString, 4)
+	case 0xc4:
+		return sized(kindBinary, 1)
+	case 0xc5:
+		return sized(kindBinary, 2)
+	case 0xc6:
+		return sized(kindBinary, 4)
+	case 0xdc:
+		return sized(kindArray, 2)
+	case 0xdd:
+		return sized(kindArray, 4)
+	case 0xde:
+		return sized(kindMap, 2)
+	case 0xdf:
+		return sized(kindMap, 4)
+	}
+
+	return header{}, fmt.Errorf("msgpack: unsupported type byte 0x%x", t)
+}
+
+func (d *decoder) decode(v reflect.Value) error {
+	h, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+
+	return d.decodeHeader(h, v)
+}
+
+func (d *decoder) decodeHeader(h header, v reflect.Value) error {
+	if h.kind == kindNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return d.decodeHeader(h, v.Elem())
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		generic, err := d.decodeGeneric(h)
+		if err != nil {
+			return err
+		}
+
+		if generic != nil {
+			v.Set(reflect.ValueOf(generic))
+		}
+		return nil
+	}
+
+	if h.kind == kindString && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		b, err := d.next(h.n)
+		if err != nil {
+			return err
+		}
+
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(b)
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("msgpack: cannot decode %s into %s", kindNames[h.kind], v.Type())
+	}
+
+	switch h.kind {
+	case kindBool:
+		if v.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		v.SetBool(h.b)
+	case kindInt, kindUint, kindFloat:
+		return setNumber(h, v, mismatch)
+	case kindString, kindBinary:
+		b, err := d.next(h.n)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte{}, b...))
+		default:
+			return mismatch()
+		}
+	case kindArray:
+		return d.decodeArray(h.n, v, mismatch)
+	case kindMap:
+		switch v.Kind() {
+		case reflect.Map:
+			return d.decodeMap(h.n, v)
+		case reflect.Struct:
+			return d.decodeStruct(h.n, v)
+		default:
+			return mismatch()
+		}
+	}
+
+	return nil
+}
+
+var kindNames = map[kind]string{
+	kindNil:    "nil",
+	kindBool:   "bool",
+	kindInt:    "int",
+	kindUint:   "uint",
+	kindFloat:  "float",
+	kindString: "string",
+	kindBinary: "binary",
+	kindArray:  "array",
+	kindMap:    "map",
+}
+
+func setNumber(h header, v reflect.Value, mismatch func() error) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch h.kind {
+		case kindInt:
+			i = h.i
+		case kindUint:
+			if h.u > math.MaxInt64 {
+				return mismatch()
+			}
+			i = int64(h.u)
+		default:
+			return mismatch()
+		}
+
+		if v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		switch {
+		case h.kind == kindUint:
+			u = h.u
+		case h.kind == kindInt && h.i >= 0:
+			u = uint64(h.i)
+		default:
+			return mismatch()
+		}
+
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: %d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch h.kind {
+		case kindFloat:
+			v.SetFloat(h.f)
+		case kindInt:
+			v.SetFloat(float64(h.i))
+		case kindUint:
+			v.SetFloat(float64(h.u))
+		}
+	default:
+		return mismatch()
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeArray(n int, v reflect.Value, mismatch func() error) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		sv := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			err := d.decode(sv.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(sv)
+	case reflect.Array:
+		if n > v.Len() {
+			return fmt.Errorf("msgpack: array of %d elements overflows %s", n, v.Type())
+		}
+
+		for i := 0; i < n; i++ {
+			err := d.decode(v.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return mismatch()
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeMap(n int, v reflect.Value) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), n))
+	}
+
+	for i := 0; i < n; i++ {
+		key := reflect.New(v.Type().Key()).Elem()
+		err := d.decode(key)
+		if err != nil {
+			return err
+		}
+
+		val := reflect.New(v.Type().Elem()).Elem()
+		err = d.decode(val)
+		if err != nil {
+			return err
+		}
+
+		v.SetMapIndex(key, val)
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeStruct(n int, v reflect.Value) error {
+	fields := structFields(v.Type())
+
+	for i := 0; i < n; i++ {
+		var key string
+		err := d.decode(reflect.ValueOf(&key).Elem())
+		if err != nil {
+			return err
+		}
+
+		f, ok := findField(fields, key)
+		if !ok {
+			if d.opts.DisallowUnknownFields {
+				return fmt.Errorf("msgpack: unknown field %q", key)
+			}
+
+			err = d.skip()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		fv, err := fieldByIndexAlloc(v, f.index)
+		if err != nil {
+			return err
+		}
+
+		err = d.decode(fv)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func findField(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
+
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, idx := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(idx)
+	}
+
+	if !v.CanSet() {
+		return v, errors.New("msgpack: cannot set embedded field")
+	}
+
+	return v, nil
+}
+
+// skip discards the next value
+func (d *decoder) skip() error {
+	h, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+
+	switch h.kind {
+	case kindString, kindBinary:
+		_, err = d.next(h.n)
+		return err
+	case kindArray:
+		for i := 0; i < h.n; i++ {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	case kindMap:
+		for i := 0; i < h.n*2; i++ {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeGeneric(h header) (interface{}, error) {
+	switch h.kind {
+	case kindNil:
+		return nil, nil
+	case kindBool:
+		return h.b, nil
+	case kindInt:
+		return h.i, nil
+	case kindUint:
+		return h.u, nil
+	case kindFloat:
+		return h.f, nil
+	case kindString:
+		b, err := d.next(h.n)
+		return string(b), err
+	case kindBinary:
+		b, err := d.next(h.n)
+		return append([]byte{}, b...), err
+	case kindArray:
+		arr := make([]interface{}, h.n)
+		for i := range arr {
+			eh, err := d.readHeader()
+			if err != nil {
+				return nil, err
+			}
+
+			arr[i], err = d.decodeGeneric(eh)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	case kindMap:
+		m := make(map[string]interface{}, h.n)
+		for i := 0; i < h.n; i++ {
+			kh, err := d.readHeader()
+			if err != nil {
+				return nil, err
+			}
+
+			k, err := d.decodeGeneric(kh)
+			if err != nil {
+				return nil, err
+			}
+
+			vh, err := d.readHeader()
+			if err != nil {
+				return nil, err
+			}
+
+			m[fmt.Sprint(k)], err = d.decodeGeneric(vh)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("msgpack: unsupported kind %d", h.kind)
+}
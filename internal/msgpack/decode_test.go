@@ -0,0 +1,86 @@
+package msgpack
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+type decodeTarget struct {
+	Name    string            `msgpack:"name"`
+	Count   int16             `json:"count"`
+	Ratio   float64           `msgpack:"ratio"`
+	Tags    []string          `msgpack:"tags"`
+	Attrs   map[string]uint32 `msgpack:"attrs"`
+	Ptr     *bool             `msgpack:"ptr"`
+	IP      net.IP            `msgpack:"ip"`
+	Raw     []byte            `msgpack:"raw"`
+	Any     interface{}       `msgpack:"any"`
+	Nothing *string           `msgpack:"nothing"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	yes := true
+	in := decodeTarget{
+		Name:  "test",
+		Count: -300,
+		Ratio: 0.25,
+		Tags:  []string{"a", "b"},
+		Attrs: map[string]uint32{"x": 70000},
+		Ptr:   &yes,
+		IP:    net.ParseIP("10.0.0.1"),
+		Raw:   []byte{1, 2, 3},
+		Any:   []interface{}{int64(-1), "x", map[string]interface{}{"k": uint64(1)}},
+	}
+
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out decodeTarget
+	err = Unmarshal(b, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch:\n%+v\n%+v", in, out)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	t.Parallel()
+
+	type small struct {
+		N int8 `msgpack:"n"`
+	}
+
+	overflow, _ := Marshal(map[string]int{"n": 1000})
+	unknown, _ := Marshal(map[string]int{"x": 1})
+	wrongType, _ := Marshal(map[string]string{"n": "x"})
+
+	cases := []struct {
+		Name string
+		Data []byte
+		Opts UnmarshalOptions
+	}{
+		{"overflow", overflow, UnmarshalOptions{}},
+		{"unknown-field", unknown, UnmarshalOptions{DisallowUnknownFields: true}},
+		{"wrong-type", wrongType, UnmarshalOptions{}},
+		{"truncated", overflow[:len(overflow)-1], UnmarshalOptions{}},
+		{"huge-length", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, UnmarshalOptions{}},
+		{"trailing", append(unknown, 0xc0), UnmarshalOptions{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var s small
+			if err := c.Opts.Unmarshal(c.Data, &s); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+// Package msgpack implements a small, reflection based MessagePack codec
+// covering the types autohttp can encode and decode
+package msgpack
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Marshal returns the MessagePack encoding of v
+//
+// Struct fields are named using the `msgpack` tag, falling back to the
+// `json` tag and then the field name, and support the omitempty option.
+// Types implementing encoding.TextMarshaler are encoded as strings
+func Marshal(v interface{}) ([]byte, error) {
+	var e encoder
+	err := e.encode(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(0xc0)
+		return nil
+	}
+
+	if v.CanInterface() && v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+
+		e.writeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(0xc3)
+		} else {
+			e.buf.WriteByte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.writeUint(v.Uint())
+	case reflect.Float32:
+		e.buf.WriteByte(0xca)
+		e.writeBig(uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.buf.WriteByte(0xcb)
+		e.writeBig(math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeBytes(v.Bytes())
+			return nil
+		}
+
+		return e.encodeArray(v)
+	case reflect.Array:
+		return e.encodeArray(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteByte(0xc0)
+			return nil
+		}
+
+		return e.encodeMap(v)
+	case reflect.Struct:
+		return e.encodeStruct(v)
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func (e *encoder) encodeArray(v reflect.Value) error {
+	e.writeArrayLen(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		err := e.encode(v.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) encodeMap(v reflect.Value) error {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+
+	e.writeMapLen(len(keys))
+	for _, k := range keys {
+		err := e.encode(k)
+		if err != nil {
+			return err
+		}
+
+		err = e.encode(v.MapIndex(k))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) encodeStruct(v reflect.Value) error {
+	fields := structFields(v.Type())
+
+	var present []field
+	for _, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		present = append(present, f)
+	}
+
+	e.writeMapLen(len(present))
+	for _, f := range present {
+		e.writeString(f.name)
+		err := e.encode(v.FieldByIndex(f.index))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields lists the encodable fields of t, flattening embedded structs
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		tag, ok := sf.Tag.Lookup("msgpack")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, f := range structFields(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, field{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+
+	return fields
+}
+
+func (e *encoder) writeBig(n uint64, size int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	e.buf.Write(b[8-size:])
+}
+
+func (e *encoder) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(uint64(i))
+	case i >= -32:
+		e.buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8:
+		e.buf.WriteByte(0xd0)
+		e.writeBig(uint64(i), 1)
+	case i >= math.MinInt16:
+		e.buf.WriteByte(0xd1)
+		e.writeBig(uint64(i), 2)
+	case i >= math.MinInt32:
+		e.buf.WriteByte(0xd2)
+		e.writeBig(uint64(i), 4)
+	default:
+		e.buf.WriteByte(0xd3)
+		e.writeBig(uint64(i), 8)
+	}
+}
+
+func (e *encoder) writeUint(u uint64) {
+	switch {
+	case u <= math.MaxInt8:
+		e.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		e.buf.WriteByte(0xcc)
+		e.writeBig(u, 1)
+	case u <= math.MaxUint16:
+		e.buf.WriteByte(0xcd)
+		e.writeBig(u, 2)
+	case u <= math.MaxUint32:
+		e.buf.WriteByte(0xce)
+		e.writeBig(u, 4)
+	default:
+		e.buf.WriteByte(0xcf)
+		e.writeBig(u, 8)
+	}
+}
+
+func (e *encoder) writeString(s string) {
+	l := len(s)
+	switch {
+	case l < 32:
+		e.buf.WriteByte(0xa0 | byte(l))
+	case l <= math.MaxUint8:
+		e.buf.WriteByte(0xd9)
+		e.writeBig(uint64(l), 1)
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xda)
+		e.writeBig(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xdb)
+		e.writeBig(uint64(l), 4)
+	}
+
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	l := len(b)
+	switch {
+	case l <= math.MaxUint8:
+		e.buf.WriteByte(0xc4)
+		e.writeBig(uint64(l), 1)
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xc5)
+		e.writeBig(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xc6)
+		e.writeBig(uint64(l), 4)
+	}
+
+	e.buf.Write(b)
+}
+
+func (e *encoder) writeArrayLen(l int) {
+	switch {
+	case l < 16:
+		e.buf.WriteByte(0x90 | byte(l))
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xdc)
+		e.writeBig(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xdd)
+		e.writeBig(uint64(l), 4)
+	}
+}
+
+func (e *encoder) writeMapLen(l int) {
+	switch {
+	case l < 16:
+		e.buf.WriteByte(0x80 | byte(l))
+	case l <= math.MaxUint16:
+		e.buf.WriteByte(0xde)
+		e.writeBig(uint64(l), 2)
+	default:
+		e.buf.WriteByte(0xdf)
+		e.writeBig(uint64(l), 4)
+	}
+}
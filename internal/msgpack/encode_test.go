@@ -0,0 +1,51 @@
+package msgpack
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		B bool `msgpack:"b"`
+	}
+
+	cases := []struct {
+		Name   string
+		Value  interface{}
+		Expect []byte
+	}{
+		{"nil", nil, []byte{0xc0}},
+		{"true", true, []byte{0xc3}},
+		{"fixint", 5, []byte{0x05}},
+		{"negative-fixint", -1, []byte{0xff}},
+		{"uint8", 200, []byte{0xcc, 0xc8}},
+		{"int16", -300, []byte{0xd1, 0xfe, 0xd4}},
+		{"float64", 1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"fixstr", "hi", []byte{0xa2, 'h', 'i'}},
+		{"bin", []byte{1, 2}, []byte{0xc4, 0x02, 1, 2}},
+		{"array", []int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{"map", map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		{"struct", struct {
+			Name  string `json:"name"`
+			Skip  string `msgpack:"-"`
+			Empty string `msgpack:"empty,omitempty"`
+			inner
+		}{Name: "x", inner: inner{B: true}}, []byte{0x82, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'x', 0xa1, 'b', 0xc3}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b, err := Marshal(c.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, c.Expect) {
+				t.Errorf("expected %x got %x", c.Expect, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package autohttp
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// introspectedRoute is a registered function route visible to generators
+type introspectedRoute struct {
+	name    string
+	method  string
+	pattern string
+	handler *Handler
+}
+
+// decodeType returns the type filled in by the route's decoder, or nil
+func (ir introspectedRoute) decodeType() reflect.Type {
+	fnType := reflect.TypeOf(ir.handler.fn)
+	for i := 0; i < fnType.NumIn(); i++ {
+		in := fnType.In(i)
+		if !isContextType(in) && !isHeaderType(in) && !isPathParamsType(in) {
+			return in
+		}
+	}
+
+	return nil
+}
+
+// routeResponse is what a route writes when it succeeds, as far as can be
+// told before its function is called
+type routeResponse struct {
+	// status is zero when the function picks it at runtime, through a
+	// Response envelope
+	status int
+	// body is nil when nothing is written, and interface{} for a Response
+	// envelope, whose body is only known at runtime
+	body reflect.Type
+}
+
+var statusCoderType = reflect.TypeOf((*StatusCoder)(nil)).Elem()
+
+// response describes the successful response of the route
+func (ir introspectedRoute) response() routeResponse {
+	fnType := reflect.TypeOf(ir.handler.fn)
+	for i := 0; i < fnType.NumOut(); i++ {
+		out := fnType.Out(i)
+		switch {
+		case isErrorType(out):
+			continue
+		case isResponseType(out):
+			return routeResponse{body: emptyInterfaceType}
+		}
+
+		status := staticStatusCode(out)
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		if !bodyAllowedForStatus(status) {
+			return routeResponse{status: status}
+		}
+
+		return routeResponse{status: status, body: out}
+	}
+
+	return routeResponse{status: http.StatusNoContent}
+}
+
+// staticStatusCode asks the zero value of a StatusCoder for its status
+// code, returning zero if t is not one or the answer depends on its value
+func staticStatusCode(t reflect.Type) (code int) {
+	defer func() {
+		if recover() != nil {
+			code = 0
+		}
+	}()
+
+	var v reflect.Value
+	switch {
+	case t.Kind() == reflect.Interface:
+		return 0
+	case t.Implements(statusCoderType) && t.Kind() == reflect.Ptr:
+		v = reflect.New(t.Elem())
+	case t.Implements(statusCoderType):
+		v = reflect.Zero(t)
+	case reflect.PtrTo(t).Implements(statusCoderType):
+		v = reflect.New(t)
+	default:
+		return 0
+	}
+
+	return v.Interface().(StatusCoder).ResponseStatusCode()
+}
+
+// introspectRoutes lists every function route not hidden from
+// introspectors, sorted by pattern and method so output is stable.
+// Raw http.Handlers carry no type information and are left out
+func (r *Router) introspectRoutes() []introspectedRoute {
+	var routes []introspectedRoute
+	for method, byPattern := range r.Routes {
+		for pattern, handler := range byPattern {
+			h, ok := handler.(*Handler)
+			if !ok || h.hideFromIntrospectors {
+				continue
+			}
+
+			routes = append(routes, introspectedRoute{method: method, pattern: pattern, handler: h})
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].pattern != routes[j].pattern {
+			return routes[i].pattern < routes[j].pattern
+		}
+		return routes[i].method < routes[j].method
+	})
+
+	used := make(map[string]bool)
+	for i := range routes {
+		name := routes[i].handler.name
+		if name == "" {
+			name = defaultRouteName(routes[i].method, routes[i].pattern, routes[i].handler.fn)
+		}
+
+		unique := name
+		for n := 2; used[unique]; n++ {
+			unique = name + strconv.Itoa(n)
+		}
+		used[unique] = true
+
+		routes[i].name = unique
+	}
+
+	return routes
+}
+
+var anonymousFuncName = regexp.MustCompile(`^func\d+$`)
+
+// defaultRouteName names a route after its function, falling back to the
+// method and path for closures
+func defaultRouteName(method, pattern string, fn interface{}) string {
+	full := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	full = strings.TrimSuffix(full, "-fm")
+	if idx := strings.LastIndexByte(full, '.'); idx != -1 {
+		full = full[idx+1:]
+	}
+
+	if full != "" && !anonymousFuncName.MatchString(full) {
+		return lowerFirst(full)
+	}
+
+	name := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(pattern, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	}) {
+		name += upperFirst(part)
+	}
+
+	return name
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
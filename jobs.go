@@ -0,0 +1,526 @@
+package autohttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+// JobState is where a job is in its lifecycle
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// Done reports whether the job has stopped running
+func (js JobState) Done() bool {
+	return js == JobSucceeded || js == JobFailed || js == JobCancelled
+}
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobNotFinished = errors.New("job has not finished")
+	ErrJobFinished    = errors.New("job has already finished")
+)
+
+// Job is the status of a single run of a job function, as reported by its
+// status endpoint
+type Job struct {
+	ID         string     `json:"id"`
+	State      JobState   `json:"state"`
+	Progress   float64    `json:"progress"`
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+
+	// Route is the path of the job route that started the job. Only its
+	// endpoints report on the job, as routes may share a JobRunner
+	Route string `json:"route"`
+
+	// Result and Err are what the function returned. A store that
+	// serializes jobs must encode Result itself
+	Result interface{} `json:"-"`
+	Err    error       `json:"-"`
+}
+
+// A JobStore keeps job state so it can be reported after the request that
+// started the job has finished
+type JobStore interface {
+	Save(job Job) error
+	// Get returns ErrJobNotFound for unknown or expired jobs
+	Get(id string) (Job, error)
+	Delete(id string) error
+}
+
+// MemoryJobStore keeps jobs in memory until they expire
+type MemoryJobStore struct {
+	mu    sync.Mutex
+	jobs  map[string]Job
+	saves int
+
+	now func() time.Time
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]Job), now: time.Now}
+}
+
+// memoryJobSweepEvery is how many saves pass between evictions
+const memoryJobSweepEvery = 256
+
+func (ms *MemoryJobStore) Save(job Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.saves++
+	if ms.saves%memoryJobSweepEvery == 0 {
+		now := ms.now()
+		for id, j := range ms.jobs {
+			if j.expired(now) {
+				delete(ms.jobs, id)
+			}
+		}
+	}
+
+	ms.jobs[job.ID] = job
+	return nil
+}
+
+func (ms *MemoryJobStore) Get(id string) (Job, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	job, ok := ms.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+
+	if job.expired(ms.now()) {
+		delete(ms.jobs, id)
+		return Job{}, ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+func (ms *MemoryJobStore) Delete(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.jobs, id)
+	return nil
+}
+
+func (j Job) expired(now time.Time) bool {
+	return j.ExpiresAt != nil && !now.Before(*j.ExpiresAt)
+}
+
+// JobRunner runs job functions in the background, at most MaxWorkers at a
+// time, keeping finished jobs in its store for TTL
+type JobRunner struct {
+	store JobStore
+	slots chan struct{}
+	ttl   time.Duration
+	log   lounge.Log
+	hook  PanicHook
+
+	// mu serializes updates, and guards cancels and closed
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	closed  bool
+}
+
+// Defaults for the JobRunner used when none is given with WithJobRunner
+const (
+	DefaultJobWorkers = 4
+	DefaultJobTTL     = time.Hour
+)
+
+func NewJobRunner(store JobStore, maxWorkers int, ttl time.Duration) (*JobRunner, error) {
+	if store == nil || maxWorkers <= 0 || ttl <= 0 {
+		return nil, errors.New("job runner needs a store, a positive worker count and a positive ttl")
+	}
+
+	return &JobRunner{
+		store:   store,
+		slots:   make(chan struct{}, maxWorkers),
+		ttl:     ttl,
+		cancels: make(map[string]context.CancelFunc),
+	}, nil
+}
+
+// WithJobRunner runs every job registered on the Router with jr
+func WithJobRunner(jr *JobRunner) func(r *Router) error {
+	return func(r *Router) error {
+		r.jobRunner = jr
+		r.closers = append(r.closers, jr.Close)
+		return nil
+	}
+}
+
+// Close cancels every pending and running job, and any started after it.
+// It does not wait for job functions to return
+func (jr *JobRunner) Close() error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	jr.closed = true
+	for _, cancel := range jr.cancels {
+		cancel()
+	}
+
+	return nil
+}
+
+type jobContextKey struct{}
+
+type jobRef struct {
+	runner *JobRunner
+	id     string
+}
+
+// GetJobID returns the ID of the job running with ctx
+func GetJobID(ctx context.Context) string {
+	ref, _ := ctx.Value(jobContextKey{}).(*jobRef)
+	if ref == nil {
+		return ""
+	}
+	return ref.id
+}
+
+// ReportJobProgress records how far along the job running with ctx is,
+// from 0 to 1, shown by its status endpoint
+func ReportJobProgress(ctx context.Context, progress float64, message string) error {
+	ref, _ := ctx.Value(jobContextKey{}).(*jobRef)
+	if ref == nil {
+		return errors.New("context does not belong to a job")
+	}
+
+	return ref.runner.update(ref.id, func(j *Job) {
+		j.Progress = progress
+		j.Message = message
+	})
+}
+
+func (jr *JobRunner) update(id string, fn func(j *Job)) error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, err := jr.store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	fn(&job)
+	return jr.store.Save(job)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// start runs h with callValues in the background, swapping in a context
+// that outlives r and is cancelled through the job's endpoint
+func (jr *JobRunner) start(id string, h *Handler, callValues []reflect.Value, r *http.Request) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), jobContextKey{}, &jobRef{runner: jr, id: id}))
+
+	jr.mu.Lock()
+	jr.cancels[id] = cancel
+	if jr.closed {
+		cancel()
+	}
+	jr.mu.Unlock()
+
+	fnType := reflect.TypeOf(h.fn)
+	for i := 0; i < fnType.NumIn(); i++ {
+		if isContextType(fnType.In(i)) {
+			callValues[i] = reflect.ValueOf(ctx)
+		}
+	}
+
+	go func() {
+		defer func() {
+			jr.mu.Lock()
+			delete(jr.cancels, id)
+			jr.mu.Unlock()
+			cancel()
+
+			if r.MultipartForm != nil {
+				r.MultipartForm.RemoveAll()
+			}
+		}()
+
+		select {
+		case jr.slots <- struct{}{}:
+		case <-ctx.Done():
+			jr.finish(ctx, id, nil, ctx.Err())
+			return
+		}
+		defer func() { <-jr.slots }()
+
+		err := jr.update(id, func(j *Job) {
+			now := time.Now()
+			j.State = JobRunning
+			j.StartedAt = &now
+		})
+		if err != nil {
+			jr.log.Errorf("could not start job %s: %s", id, err)
+			return
+		}
+
+		value, err := jr.call(h, callValues, r)
+		jr.finish(ctx, id, value, err)
+	}()
+}
+
+func (jr *JobRunner) call(h *Handler, callValues []reflect.Value, r *http.Request) (value interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			pe := &PanicError{Value: rec, Stack: debug.Stack()}
+			jr.log.Errorf("panic running job for %s %s: %v\n%s", r.Method, r.URL.Path, rec, pe.Stack)
+			if jr.hook != nil {
+				jr.hook(r, pe)
+			}
+			err = pe
+		}
+	}()
+
+	return h.call(callValues)
+}
+
+func (jr *JobRunner) finish(ctx context.Context, id string, value interface{}, err error) {
+	uerr := jr.update(id, func(j *Job) {
+		now := time.Now()
+		expires := now.Add(jr.ttl)
+		j.FinishedAt = &now
+		j.ExpiresAt = &expires
+
+		switch {
+		case err != nil && errors.Is(ctx.Err(), context.Canceled):
+			j.State = JobCancelled
+		case err != nil:
+			j.State = JobFailed
+			j.Error = err.Error()
+			j.Err = err
+		default:
+			j.State = JobSucceeded
+			j.Progress = 1
+			j.Result = value
+		}
+	})
+	if uerr != nil {
+		jr.log.Errorf("could not finish job %s: %s", id, uerr)
+	}
+}
+
+// cancel stops a queued or running job started by this runner
+func (jr *JobRunner) cancel(id string) bool {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	cancel, ok := jr.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// jobIDParam is the path param holding the job ID in generated endpoints
+const jobIDParam = "jobID"
+
+// RegisterJob adds fn as a long running job at path. A POST to path
+// decodes and validates the input as Register would, then returns 202 with
+// the job status and a Location for it, and runs fn in the background with
+// a context that is cancelled if the job is.
+//
+// Three endpoints are generated for each job:
+//
+//	GET    path/{jobID}         status and progress
+//	GET    path/{jobID}/result  the encoded return value, once finished
+//	DELETE path/{jobID}         cancel the job
+//
+// fn may report progress with ReportJobProgress. Jobs are hidden from
+// introspectors, as their endpoints do not return fn's output directly
+func (r *Router) RegisterJob(path string, fn interface{}, opts ...RouteOption) error {
+	return r.registerJob(path, fn, nil, opts)
+}
+
+func (r *Router) registerJob(path string, fn interface{}, groupMiddleware []Middleware, opts []RouteOption) error {
+	if r.jobRunner == nil {
+		jr, err := NewJobRunner(NewMemoryJobStore(), DefaultJobWorkers, DefaultJobTTL)
+		if err != nil {
+			return err
+		}
+		r.jobRunner = jr
+		r.closers = append(r.closers, jr.Close)
+	}
+
+	if r.jobRunner.log == nil {
+		r.jobRunner.log = r.log
+	}
+	if r.jobRunner.hook == nil {
+		r.jobRunner.hook = r.panicHook
+	}
+
+	rc, err := r.resolveRouteConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	h, err := NewHandler(r.log, rc.decoder, rc.encoder, rc.errorHandler, fn)
+	if err != nil {
+		return err
+	}
+	h.errorMap = r.errorMap
+
+	jh := &jobHandlers{runner: r.jobRunner, h: h, route: path}
+	jobPath := path + "/{" + jobIDParam + "}"
+
+	routes := []struct {
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{http.MethodPost, path, jh.start},
+		{http.MethodGet, jobPath, jh.status},
+		{http.MethodGet, jobPath + "/result", jh.result},
+		{http.MethodDelete, jobPath, jh.cancel},
+	}
+
+	for _, route := range routes {
+		err := r.register(route.method, route.path, route.handler, groupMiddleware, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type jobHandlers struct {
+	runner *JobRunner
+	h      *Handler
+	route  string
+}
+
+func writeJob(w http.ResponseWriter, code int, job Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (jh *jobHandlers) start(w http.ResponseWriter, r *http.Request) {
+	callValues, err := jh.h.prepareCall(r)
+	if err != nil {
+		jh.h.handleError(w, r, err)
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		jh.h.handleError(w, r, err)
+		return
+	}
+
+	job := Job{ID: id, Route: jh.route, State: JobQueued, CreatedAt: time.Now()}
+	err = jh.runner.store.Save(job)
+	if err != nil {
+		jh.h.handleError(w, r, err)
+		return
+	}
+
+	jh.runner.start(id, jh.h, callValues, r)
+
+	w.Header().Set("Location", r.URL.Path+"/"+id)
+	writeJob(w, http.StatusAccepted, job)
+}
+
+func (jh *jobHandlers) lookup(w http.ResponseWriter, r *http.Request) (Job, bool) {
+	job, err := jh.runner.store.Get(GetPathParams(r)[jobIDParam])
+	if err == nil && job.Route != jh.route {
+		err = ErrJobNotFound
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrJobNotFound) {
+			err = ErrorWithCode{Err: err, StatusCode: http.StatusNotFound}
+		}
+		jh.h.handleError(w, r, err)
+		return Job{}, false
+	}
+
+	return job, true
+}
+
+func (jh *jobHandlers) status(w http.ResponseWriter, r *http.Request) {
+	job, ok := jh.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	writeJob(w, http.StatusOK, job)
+}
+
+func (jh *jobHandlers) result(w http.ResponseWriter, r *http.Request) {
+	job, ok := jh.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	switch job.State {
+	case JobSucceeded:
+		jh.h.writeValue(w, r, job.Result)
+	case JobFailed:
+		err := job.Err
+		if err == nil {
+			err = errors.New(job.Error)
+		}
+		jh.h.handleError(w, r, err)
+	case JobCancelled:
+		jh.h.handleError(w, r, ErrorWithCode{Err: context.Canceled, StatusCode: http.StatusConflict})
+	default:
+		jh.h.handleError(w, r, ErrorWithCode{Err: ErrJobNotFinished, StatusCode: http.StatusConflict})
+	}
+}
+
+func (jh *jobHandlers) cancel(w http.ResponseWriter, r *http.Request) {
+	job, ok := jh.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	if job.State.Done() {
+		jh.h.handleError(w, r, ErrorWithCode{Err: ErrJobFinished, StatusCode: http.StatusConflict})
+		return
+	}
+
+	if !jh.runner.cancel(job.ID) {
+		jh.h.handleError(w, r, ErrorWithCode{Err: errors.New("job is running on another server"), StatusCode: http.StatusConflict})
+		return
+	}
+
+	writeJob(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,251 @@
+package autohttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+type jobTestInput struct {
+	N int `json:"n" validate:"min=1"`
+}
+
+func newJobTestRouter(t *testing.T, fn interface{}) *Router {
+	t.Helper()
+
+	jr, err := NewJobRunner(NewMemoryJobStore(), 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithJobRunner(jr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.RegisterJob("/reports", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func serveJob(t *testing.T, r *Router, method, path, body string) (*httptest.ResponseRecorder, Job) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var job Job
+	json.Unmarshal(w.Body.Bytes(), &job)
+	return w, job
+}
+
+// waitForJob polls the status endpoint until the job is done
+func waitForJob(t *testing.T, r *Router, id string) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_, job := serveJob(t, r, http.MethodGet, "/reports/"+id, "")
+		if job.State.Done() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatal("job did not finish")
+	return Job{}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	release := make(chan struct{})
+	r := newJobTestRouter(t, func(ctx context.Context, in *jobTestInput) ([]int, error) {
+		ReportJobProgress(ctx, 0.5, "halfway")
+		<-release
+
+		if in.N == 13 {
+			return nil, NewErrorWithCode(errors.New("unlucky"), http.StatusTeapot)
+		}
+		return []int{in.N, in.N * 2}, nil
+	})
+
+	w, _ := serveJob(t, r, http.MethodPost, "/reports", `{"n":0}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected invalid input to be rejected up front, got %d", w.Code)
+	}
+
+	w, job := serveJob(t, r, http.MethodPost, "/reports", `{"n":2}`)
+	if w.Code != http.StatusAccepted || job.ID == "" || job.State != JobQueued {
+		t.Fatalf("unexpected start %d %+v", w.Code, job)
+	}
+
+	if w.Header().Get("Location") != "/reports/"+job.ID {
+		t.Errorf("unexpected location %q", w.Header().Get("Location"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Message != "halfway" && time.Now().Before(deadline) {
+		_, job = serveJob(t, r, http.MethodGet, "/reports/"+job.ID, "")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if job.State != JobRunning || job.Progress != 0.5 {
+		t.Errorf("expected running job at 0.5, got %+v", job)
+	}
+
+	w, _ = serveJob(t, r, http.MethodGet, "/reports/"+job.ID+"/result", "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected unfinished result to conflict, got %d", w.Code)
+	}
+
+	close(release)
+	job = waitForJob(t, r, job.ID)
+	if job.State != JobSucceeded || job.Progress != 1 || job.ExpiresAt == nil {
+		t.Errorf("unexpected finished job %+v", job)
+	}
+
+	w, _ = serveJob(t, r, http.MethodGet, "/reports/"+job.ID+"/result", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[2,4]" {
+		t.Errorf("unexpected result %d %q", w.Code, w.Body.String())
+	}
+
+	w, _ = serveJob(t, r, http.MethodDelete, "/reports/"+job.ID, "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected cancelling a finished job to conflict, got %d", w.Code)
+	}
+
+	_, failed := serveJob(t, r, http.MethodPost, "/reports", `{"n":13}`)
+	failed = waitForJob(t, r, failed.ID)
+	if failed.State != JobFailed || failed.Error != "unlucky" {
+		t.Errorf("unexpected failed job %+v", failed)
+	}
+
+	w, _ = serveJob(t, r, http.MethodGet, "/reports/"+failed.ID+"/result", "")
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected the job's error code, got %d", w.Code)
+	}
+
+	w, _ = serveJob(t, r, http.MethodGet, "/reports/missing", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	r := newJobTestRouter(t, func(ctx context.Context, in *jobTestInput) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	// the runner has one worker, so the second job waits in the queue
+	_, running := serveJob(t, r, http.MethodPost, "/reports", `{"n":1}`)
+	_, queued := serveJob(t, r, http.MethodPost, "/reports", `{"n":1}`)
+
+	for _, id := range []string{queued.ID, running.ID} {
+		w, _ := serveJob(t, r, http.MethodDelete, "/reports/"+id, "")
+		if w.Code != http.StatusAccepted {
+			t.Errorf("expected cancel to be accepted, got %d", w.Code)
+		}
+
+		job := waitForJob(t, r, id)
+		if job.State != JobCancelled {
+			t.Errorf("expected cancelled job, got %+v", job)
+		}
+	}
+}
+
+func TestJobCancelOnClose(t *testing.T) {
+	r := newJobTestRouter(t, func(ctx context.Context, in *jobTestInput) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	_, running := serveJob(t, r, http.MethodPost, "/reports", `{"n":1}`)
+	_, queued := serveJob(t, r, http.MethodPost, "/reports", `{"n":1}`)
+
+	err := r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, late := serveJob(t, r, http.MethodPost, "/reports", `{"n":1}`)
+
+	for _, id := range []string{running.ID, queued.ID, late.ID} {
+		job := waitForJob(t, r, id)
+		if job.State != JobCancelled {
+			t.Errorf("expected closing the router to cancel the job, got %+v", job)
+		}
+	}
+}
+
+func TestJobRoutesAreSeparate(t *testing.T) {
+	r := newJobTestRouter(t, func(ctx context.Context, in *jobTestInput) (map[string]int, error) {
+		return map[string]int{"a": in.N}, nil
+	})
+
+	err := r.RegisterJob("/other", func(ctx context.Context, in *jobTestInput) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, job := serveJob(t, r, http.MethodPost, "/reports", `{"n":7}`)
+	job = waitForJob(t, r, job.ID)
+	if job.Route != "/reports" {
+		t.Errorf("expected the job to belong to /reports, got %q", job.Route)
+	}
+
+	for _, c := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/other/" + job.ID},
+		{http.MethodGet, "/other/" + job.ID + "/result"},
+		{http.MethodDelete, "/other/" + job.ID},
+	} {
+		w, _ := serveJob(t, r, c.method, c.path, "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected another route's job to be hidden, got %d %q", c.method, c.path, w.Code, w.Body.String())
+		}
+	}
+
+	w, _ := serveJob(t, r, http.MethodGet, "/reports/"+job.ID+"/result", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"a":7}` {
+		t.Errorf("unexpected result %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMemoryJobStoreExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	ms := NewMemoryJobStore()
+	ms.now = func() time.Time { return now }
+
+	expires := now.Add(time.Minute)
+	err := ms.Save(Job{ID: "a", ExpiresAt: &expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ms.Get("a"); err != nil {
+		t.Errorf("expected job before expiry, got %s", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := ms.Get("a"); err != ErrJobNotFound {
+		t.Errorf("expected expired job to be gone, got %v", err)
+	}
+}
@@ -67,6 +67,16 @@ func TestJSONDecoderValidation(t *testing.T) {
 			func(ctx context.Context, h Header, in struct{ X int }) {},
 			false,
 		},
+		{
+			"params-struct",
+			func(ctx context.Context, pp PathParams, in struct{ X int }) {},
+			false,
+		},
+		{
+			"duplicate-params",
+			func(pp PathParams, pp2 PathParams) {},
+			true,
+		},
 		{
 			"duplicate args",
 			func(ctx context.Context, ctx2 context.Context) {},
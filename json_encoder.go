@@ -3,13 +3,29 @@ package autohttp
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 )
 
 type JSONEncoder struct{}
 
 func (jse *JSONEncoder) ValidateType(fn interface{}) error {
+	rt := encodableReturnType(fn)
+	if rt == nil {
+		return nil
+	}
+
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch rt.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return fmt.Errorf("json encoder cannot encode %s", rt)
+	}
+
 	return nil
 }
 
@@ -24,3 +40,7 @@ func (jse *JSONEncoder) Encode(value interface{}, hw HeaderWriter) (int, io.Read
 
 	return http.StatusOK, &b, nil
 }
+
+func (jse *JSONEncoder) MediaType() string {
+	return "application/json"
+}
@@ -0,0 +1,308 @@
+package autohttp
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSONSchema is the subset of JSON Schema (draft 2020-12) generated from Go types
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+}
+
+var (
+	jsonRawMessageType = reflect.TypeOf(json.RawMessage{})
+	emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// schemaGenerator builds JSON Schemas for Go types, collecting named struct
+// types as reusable components referenced with $ref
+type schemaGenerator struct {
+	// tag is the struct tag used to name properties
+	tag string
+
+	components map[string]*JSONSchema
+	names      map[reflect.Type]string
+	taken      map[string]reflect.Type
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		tag:        "json",
+		components: make(map[string]*JSONSchema),
+		names:      make(map[reflect.Type]string),
+		taken:      make(map[string]reflect.Type),
+	}
+}
+
+var invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// componentName picks a stable, unique component name for a named type
+func (sg *schemaGenerator) componentName(t reflect.Type) string {
+	if name, ok := sg.names[t]; ok {
+		return name
+	}
+
+	name := invalidComponentChars.ReplaceAllString(t.Name(), "_")
+	if other, ok := sg.taken[name]; ok && other != t {
+		pkg := t.PkgPath()
+		if idx := strings.LastIndexByte(pkg, '/'); idx != -1 {
+			pkg = pkg[idx+1:]
+		}
+		name = invalidComponentChars.ReplaceAllString(pkg, "_") + "." + name
+
+		for i := 2; sg.taken[name] != nil; i++ {
+			name = strings.TrimRight(name, "0123456789") + strconv.Itoa(i)
+		}
+	}
+
+	sg.names[t] = name
+	sg.taken[name] = t
+	return name
+}
+
+// schemaFor returns the schema of t, registering named structs as components
+func (sg *schemaGenerator) schemaFor(t reflect.Type) *JSONSchema {
+	if t.Kind() == reflect.Ptr {
+		inner := sg.schemaFor(t.Elem())
+		return nullable(inner)
+	}
+
+	switch {
+	case t == timeType:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case t == formFileType.Elem():
+		return &JSONSchema{Type: "string", Format: "binary"}
+	case t == jsonRawMessageType || t == emptyInterfaceType:
+		return &JSONSchema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &JSONSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &JSONSchema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &JSONSchema{Type: "integer", Format: "int32"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &JSONSchema{Type: "integer", Minimum: &zero}
+	case reflect.Float32:
+		return &JSONSchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &JSONSchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &JSONSchema{Type: "array", Items: sg.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: sg.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sg.structSchema(t)
+		}
+
+		name := sg.componentName(t)
+		if _, ok := sg.components[name]; !ok {
+			// reserve the name first so recursive types terminate
+			sg.components[name] = &JSONSchema{}
+			*sg.components[name] = *sg.structSchema(t)
+		}
+
+		return &JSONSchema{Ref: "#/components/schemas/" + name}
+	}
+
+	return &JSONSchema{}
+}
+
+// rootSchema is the schema of a whole request or response body, where a
+// pointer only reflects how the value is passed rather than nullability
+func (sg *schemaGenerator) rootSchema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return sg.schemaFor(t)
+}
+
+func nullable(s *JSONSchema) *JSONSchema {
+	if s.Ref != "" {
+		return &JSONSchema{AnyOf: []*JSONSchema{s, {Type: "null"}}}
+	}
+
+	if typ, ok := s.Type.(string); ok {
+		s.Type = []string{typ, "null"}
+	}
+
+	return s
+}
+
+// schemaProperty describes a single struct field as it appears in a schema
+type schemaProperty struct {
+	name      string
+	field     reflect.StructField
+	omitEmpty bool
+}
+
+// schemaProperties lists the fields of t under the generator's tag,
+// flattening embedded structs the way encoding/json does
+func (sg *schemaGenerator) schemaProperties(t reflect.Type) []schemaProperty {
+	var props []schemaProperty
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag := sf.Tag.Get(sg.tag)
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.IndexByte(tag, ','); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				props = append(props, sg.schemaProperties(ft)...)
+				continue
+			}
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		props = append(props, schemaProperty{
+			name:      name,
+			field:     sf,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+
+	return props
+}
+
+func (sg *schemaGenerator) structSchema(t reflect.Type) *JSONSchema {
+	s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+	for _, p := range sg.schemaProperties(t) {
+		ps := sg.schemaFor(p.field.Type)
+		if applyValidateTag(ps, p.field) {
+			s.Required = append(s.Required, p.name)
+		}
+
+		if doc := p.field.Tag.Get("doc"); doc != "" {
+			ps.Description = doc
+		}
+
+		s.Properties[p.name] = ps
+	}
+
+	return s
+}
+
+// applyValidateTag copies the constraints of a `validate` tag onto s,
+// returning true if the field is required
+func applyValidateTag(s *JSONSchema, sf reflect.StructField) bool {
+	tag := sf.Tag.Get("validate")
+	if tag == "" || tag == "-" || s.Ref != "" {
+		return strings.Contains(","+tag+",", ",required,")
+	}
+
+	ft := sf.Type
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+
+	var required bool
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg := rule, ""
+		if idx := strings.IndexByte(rule, '='); idx != -1 {
+			name, arg = rule[:idx], rule[idx+1:]
+		}
+
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "oneof":
+			for _, o := range strings.Fields(arg) {
+				if ft.Kind() == reflect.String {
+					s.Enum = append(s.Enum, o)
+				} else if n, err := strconv.ParseFloat(o, 64); err == nil {
+					s.Enum = append(s.Enum, n)
+				}
+			}
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			applyBound(s, ft.Kind(), name, n)
+		}
+	}
+
+	return required
+}
+
+func applyBound(s *JSONSchema, kind reflect.Kind, rule string, n float64) {
+	count := int(n)
+	switch kind {
+	case reflect.String:
+		if rule != "max" {
+			s.MinLength = &count
+		}
+		if rule != "min" {
+			s.MaxLength = &count
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if rule != "max" {
+			s.MinItems = &count
+		}
+		if rule != "min" {
+			s.MaxItems = &count
+		}
+	default:
+		if rule == "min" {
+			s.Minimum = &n
+		}
+		if rule == "max" {
+			s.Maximum = &n
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package autohttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/fortytw2/autohttp/internal/httpsnoop"
+)
+
+// WithMethods allows routes to be registered for methods beyond GET, POST,
+// PUT, PATCH and DELETE, such as HEAD to replace the automatic HEAD
+// handling, OPTIONS to answer preflights yourself, or extension methods
+// such as PROPFIND
+func WithMethods(methods ...string) func(r *Router) error {
+	return func(r *Router) error {
+		for _, m := range methods {
+			if !isToken(m) {
+				return fmt.Errorf("invalid http method: %q", m)
+			}
+
+			// requests are matched upper case
+			r.methods[strings.ToUpper(m)] = true
+		}
+
+		return nil
+	}
+}
+
+// isToken reports whether s is a valid method name, an RFC 9110 token
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// findRoute finds the node serving method at u, serving HEAD from GET
+// when no HEAD route is registered
+func (r *Router) findRoute(u *url.URL, method string) (*routeNode, string, PathParams) {
+	path, escaped := routingPath(u)
+
+	node, pp := r.tree.lookupMethod(path, method)
+	if node == nil && method == http.MethodHead {
+		node, pp = r.tree.lookupMethod(path, http.MethodGet)
+		method = http.MethodGet
+	}
+
+	if escaped {
+		unescapeParams(pp)
+	}
+
+	return node, method, pp
+}
+
+// allowedMethods lists every method with a route matching u, sorted
+func (r *Router) allowedMethods(u *url.URL) []string {
+	path, _ := routingPath(u)
+
+	var methods []string
+	for method := range r.Routes {
+		if node, _ := r.tree.lookupMethod(path, method); node != nil {
+			methods = append(methods, method)
+		}
+	}
+
+	hasGet, hasHead := false, false
+	for _, m := range methods {
+		hasGet = hasGet || m == http.MethodGet
+		hasHead = hasHead || m == http.MethodHead
+	}
+
+	if hasGet && !hasHead {
+		methods = append(methods, http.MethodHead)
+	}
+
+	sort.Strings(methods)
+	return methods
+}
+
+// serveMethodNotAllowed answers a request for a path that only exists under
+// other methods
+func (r *Router) serveMethodNotAllowed(w http.ResponseWriter, methods []string) {
+	hasOptions := false
+	for _, m := range methods {
+		hasOptions = hasOptions || m == http.MethodOptions
+	}
+
+	if !hasOptions {
+		methods = append(methods, http.MethodOptions)
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+// discardBody wraps w for a HEAD request served by a GET route, keeping
+// the status and headers but dropping the body
+func discardBody(w http.ResponseWriter) http.ResponseWriter {
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				return len(b), nil
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				return io.Copy(io.Discard, src)
+			}
+		},
+	})
+}
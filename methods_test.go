@@ -0,0 +1,100 @@
+package autohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestMethodRouting(t *testing.T) {
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithMethods("propfind"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(ctx context.Context, pp PathParams) (map[string]string, error) {
+		return map[string]string{"id": pp["id"]}, nil
+	}
+
+	routes := []struct {
+		Method string
+		Path   string
+		Fn     interface{}
+		Opts   []RouteOption
+	}{
+		{http.MethodGet, "/users/{id}", get, []RouteOption{WithRouteDecoder(NewQueryDecoder())}},
+		{http.MethodDelete, "/users/{id}", func(ctx context.Context) error { return nil }, nil},
+		{http.MethodPost, "/users/new", func(ctx context.Context) error { return nil }, nil},
+		{"PROPFIND", "/dav/*", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(207)
+		}), nil},
+	}
+
+	for _, rt := range routes {
+		err = r.Register(rt.Method, rt.Path, rt.Fn, rt.Opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = r.Register("TRACE", "/trace", func(ctx context.Context) error { return nil })
+	if err == nil {
+		t.Error("expected TRACE to need WithMethods")
+	}
+
+	cases := []struct {
+		Name         string
+		Method       string
+		Path         string
+		ExpectStatus int
+		ExpectAllow  string
+		ExpectBody   string
+	}{
+		{"get", http.MethodGet, "/users/1", http.StatusOK, "", `{"id":"1"}`},
+		{"get-falls-back-to-param", http.MethodGet, "/users/new", http.StatusOK, "", `{"id":"new"}`},
+		{"head", http.MethodHead, "/users/1", http.StatusOK, "", ""},
+		{"method-not-allowed", http.MethodPut, "/users/1", http.StatusMethodNotAllowed, "DELETE, GET, HEAD, OPTIONS", ""},
+		{"method-not-allowed-static", http.MethodPut, "/users/new", http.StatusMethodNotAllowed, "DELETE, GET, HEAD, POST, OPTIONS", ""},
+		{"head-without-get", http.MethodHead, "/dav/x", http.StatusMethodNotAllowed, "PROPFIND, OPTIONS", ""},
+		{"options", http.MethodOptions, "/users/1", http.StatusNoContent, "DELETE, GET, HEAD, OPTIONS", ""},
+		{"extension", "PROPFIND", "/dav/x", 207, "", ""},
+		{"not-found", http.MethodPut, "/missing", http.StatusNotFound, "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(c.Method, c.Path, nil))
+
+			if w.Code != c.ExpectStatus {
+				t.Errorf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+
+			if got := w.Header().Get("Allow"); got != c.ExpectAllow {
+				t.Errorf("expected Allow %q got %q", c.ExpectAllow, got)
+			}
+
+			if got := strings.TrimSpace(w.Body.String()); got != c.ExpectBody {
+				t.Errorf("expected body %q got %q", c.ExpectBody, got)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/users/1", nil))
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected HEAD to keep the GET headers, got %v", w.Header())
+	}
+}
+
+func TestWithMethodsInvalid(t *testing.T) {
+	_, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithMethods("BAD METHOD"))
+	if err == nil {
+		t.Error("expected an invalid method to be rejected")
+	}
+}
@@ -0,0 +1,155 @@
+package autohttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fortytw2/autohttp/internal/httpsnoop"
+)
+
+// RouteMetrics describes a single request served by the Router
+type RouteMetrics struct {
+	// Pattern is the route pattern that served the request, such as
+	// /users/{id}, or empty when no route matched
+	Pattern string
+	// Method is the request method, or OTHER for methods the Router
+	// does not serve, so clients cannot create unbounded label values
+	Method   string
+	Status   int
+	Duration time.Duration
+	BytesIn  int64
+	BytesOut int64
+
+	// Decode covers middleware, decoding and validation, Handler the
+	// function itself, and Encode writing its result. They are zero for
+	// raw http.Handlers
+	Decode  time.Duration
+	Handler time.Duration
+	Encode  time.Duration
+}
+
+// A MetricsCollector receives the metrics of every request served by the
+// Router, such as to forward them to a monitoring system. Collect is
+// called concurrently
+type MetricsCollector interface {
+	Collect(r *http.Request, m RouteMetrics)
+}
+
+// MetricsCollectorFunc adapts a function to a MetricsCollector
+type MetricsCollectorFunc func(r *http.Request, m RouteMetrics)
+
+func (f MetricsCollectorFunc) Collect(r *http.Request, m RouteMetrics) {
+	f(r, m)
+}
+
+// WithMetricsCollector sends the metrics of every request to mc
+func WithMetricsCollector(mc MetricsCollector) func(r *Router) error {
+	return func(r *Router) error {
+		r.metricsCollectors = append(r.metricsCollectors, mc)
+		return nil
+	}
+}
+
+type routeMetricsKey struct{}
+
+func getRouteMetrics(r *http.Request) *RouteMetrics {
+	rm, _ := r.Context().Value(routeMetricsKey{}).(*RouteMetrics)
+	return rm
+}
+
+type metricsPhase int
+
+const (
+	phaseDecode metricsPhase = iota
+	phaseHandler
+	phaseEncode
+)
+
+// record adds the time since start to phase, returning the start of the
+// next phase. rm may be nil when metrics are not being collected
+func (rm *RouteMetrics) record(phase metricsPhase, start time.Time) time.Time {
+	if rm == nil {
+		return start
+	}
+
+	now := time.Now()
+	switch phase {
+	case phaseDecode:
+		rm.Decode += now.Sub(start)
+	case phaseHandler:
+		rm.Handler += now.Sub(start)
+	case phaseEncode:
+		rm.Encode += now.Sub(start)
+	}
+
+	return now
+}
+
+// setRoutePattern records the route that matched req, if metrics are
+// collected or the request is traced
+func setRoutePattern(req *http.Request, pattern string) {
+	if rm := getRouteMetrics(req); rm != nil {
+		rm.Pattern = pattern
+	}
+
+	if s := SpanFromContext(req.Context()); s != nil {
+		s.setName(req.Method + " " + pattern)
+		s.SetAttribute("http.route", pattern)
+	}
+}
+
+// countingBody counts the bytes of the request body read by the route
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (cb countingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	*cb.n += int64(n)
+	return n, err
+}
+
+// otherMethod is recorded for methods the Router does not serve
+const otherMethod = "OTHER"
+
+// metricsMethod bounds the methods seen by collectors to those the Router
+// serves, including the HEAD and OPTIONS it answers itself
+func (r *Router) metricsMethod(method string) string {
+	if r.methods[method] || method == http.MethodHead || method == http.MethodOptions {
+		return method
+	}
+	return otherMethod
+}
+
+// serveInstrumented serves req inside its trace span, then hands its
+// metrics to every collector
+func (r *Router) serveInstrumented(w http.ResponseWriter, req *http.Request) {
+	var span *Span
+	if r.tracer != nil {
+		req, span = r.tracer.startRequestSpan(req)
+	}
+
+	rm := &RouteMetrics{Method: r.metricsMethod(req.Method)}
+	req = req.WithContext(context.WithValue(req.Context(), routeMetricsKey{}, rm))
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = countingBody{ReadCloser: req.Body, n: &rm.BytesIn}
+	}
+
+	m := httpsnoop.CaptureMetrics(http.HandlerFunc(r.internalServeHTTP), w, req)
+	rm.Status = m.Code
+	rm.Duration = m.Duration
+	rm.BytesOut = m.Written
+
+	endRequestSpan(span, rm.Status)
+
+	if r.enableRouteMetrics {
+		r.log.Debugf("served %d bytes for %s %s (%s) in %s with code %d", rm.BytesOut, req.Method, req.URL.Path, rm.Pattern, rm.Duration, rm.Status)
+	}
+
+	for _, mc := range r.metricsCollectors {
+		mc.Collect(req, *rm)
+	}
+}
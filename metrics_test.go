@@ -0,0 +1,159 @@
+package autohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+type echoInput struct {
+	Name string `json:"name"`
+}
+
+func TestMetricsCollector(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		metrics []RouteMetrics
+	)
+	collector := MetricsCollectorFunc(func(r *http.Request, m RouteMetrics) {
+		mu.Lock()
+		defer mu.Unlock()
+		metrics = append(metrics, m)
+	})
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithMetricsCollector(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/echo/{id}", func(ctx context.Context, in *echoInput) (*echoInput, error) {
+		return in, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/raw", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name          string
+		Path          string
+		Body          string
+		ExpectPattern string
+		ExpectStatus  int
+		ExpectIn      int64
+		ExpectOut     int64
+		ExpectPhases  bool
+	}{
+		{"handler", "/echo/1", `{"name":"x"}`, "/echo/{id}", http.StatusOK, 12, 13, true},
+		{"raw", "/raw", `{}`, "/raw", http.StatusAccepted, 2, 0, false},
+		{"not-found", "/missing", ``, "", http.StatusNotFound, 0, 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			metrics = nil
+
+			req := httptest.NewRequest(http.MethodPost, c.Path, strings.NewReader(c.Body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if len(metrics) != 1 {
+				t.Fatalf("expected 1 collected request got %d", len(metrics))
+			}
+
+			m := metrics[0]
+			if m.Pattern != c.ExpectPattern || m.Method != http.MethodPost || m.Status != c.ExpectStatus {
+				t.Errorf("unexpected route metrics %+v", m)
+			}
+
+			if m.BytesIn != c.ExpectIn || m.BytesOut != c.ExpectOut {
+				t.Errorf("expected %d bytes in and %d out, got %d and %d", c.ExpectIn, c.ExpectOut, m.BytesIn, m.BytesOut)
+			}
+
+			phases := m.Decode > 0 && m.Handler > 0 && m.Encode > 0
+			if phases != c.ExpectPhases {
+				t.Errorf("expected phases %v got %+v", c.ExpectPhases, m)
+			}
+
+			if m.Decode+m.Handler+m.Encode > m.Duration {
+				t.Errorf("phases exceed the request duration %+v", m)
+			}
+		})
+	}
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	pc := NewPrometheusCollector(0.1, 1)
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithMetricsRoute("/metrics", pc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/users/{id}", func(ctx context.Context) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// methods the router does not serve share one label value
+	for _, method := range []string{"BOGUS1", "BOGUS2"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/users/1", nil))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Header().Get("Content-Type") != prometheusContentType {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	for _, expect := range []string{
+		"# TYPE autohttp_requests_total counter\n",
+		`autohttp_requests_total{method="POST",route="/users/{id}",status="200"} 2` + "\n",
+		`autohttp_request_bytes_total{method="POST",route="/users/{id}"} 4` + "\n",
+		"# TYPE autohttp_request_duration_seconds histogram\n",
+		`autohttp_request_duration_seconds_bucket{method="POST",route="/users/{id}",le="0.1"} 2` + "\n",
+		`autohttp_request_duration_seconds_bucket{method="POST",route="/users/{id}",le="+Inf"} 2` + "\n",
+		`autohttp_request_duration_seconds_count{method="POST",route="/users/{id}"} 2` + "\n",
+		`autohttp_request_phase_duration_seconds_count{method="POST",route="/users/{id}",phase="handler"} 2` + "\n",
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", expect, body)
+		}
+	}
+
+	if strings.Contains(body, "/users/1") {
+		t.Error("expected metrics to be labelled by route pattern, not path")
+	}
+
+	if strings.Contains(body, "BOGUS") || strings.Count(body, "autohttp_requests_total{method=\"OTHER\"") != 1 {
+		t.Errorf("expected unknown methods to be recorded as OTHER, got:\n%s", body)
+	}
+}
+
+func TestMetricLabelsEscaping(t *testing.T) {
+	got := metricLabels{method: "GET", route: "/a\"b\\c\n"}.String()
+	expect := `method="GET",route="/a\"b\\c\n"`
+	if got != expect {
+		t.Errorf("expected %s got %s", expect, got)
+	}
+}
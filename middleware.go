@@ -10,11 +10,47 @@ import (
 // Middleware is used for things such as authentication / authorization controls
 // checking specific headers of a request
 // etc
+//
+// Middleware registered on a Router runs first, followed by the middleware of
+// each enclosing RouteGroup (outermost first), and finally middleware given to
+// Register for the route itself
 type Middleware interface {
 	// Before can modify an incoming request in the middleware chain
+	// h is nil when the route is a plain http.Handler
 	Before(r *http.Request, h *Handler) error
 }
 
+// middlewareHandler runs a middleware chain in front of a plain http.Handler
+type middlewareHandler struct {
+	middleware   []Middleware
+	errorHandler ErrorHandler
+	next         http.Handler
+}
+
+func (mh *middlewareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, mw := range mh.middleware {
+		err := mw.Before(r, nil)
+		if err != nil {
+			mh.errorHandler(w, r, err)
+			return
+		}
+	}
+
+	mh.next.ServeHTTP(w, r)
+}
+
+func wrapMiddleware(h http.Handler, middleware []Middleware, errorHandler ErrorHandler) http.Handler {
+	if len(middleware) == 0 {
+		return h
+	}
+
+	return &middlewareHandler{
+		middleware:   middleware,
+		errorHandler: errorHandler,
+		next:         h,
+	}
+}
+
 type MiddlewareError struct {
 	StatusCode int
 	Err        error
@@ -24,6 +60,10 @@ func (mwe MiddlewareError) Error() string {
 	return mwe.Err.Error()
 }
 
+func (mwe MiddlewareError) Unwrap() error {
+	return mwe.Err
+}
+
 // SignedHeadersMiddleware validates that all incoming headers are signed using a certain key
 // if they're set as a header outgoing, they'll also be signed on the way out.
 // this works great for cookies and the like
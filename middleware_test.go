@@ -0,0 +1,147 @@
+package autohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+type recordingMiddleware struct {
+	name  string
+	calls *[]string
+}
+
+func (rm recordingMiddleware) Before(r *http.Request, h *Handler) error {
+	*rm.calls = append(*rm.calls, rm.name)
+	return nil
+}
+
+type rejectingMiddleware struct{}
+
+func (rejectingMiddleware) Before(r *http.Request, h *Handler) error {
+	return MiddlewareError{StatusCode: http.StatusUnauthorized, Err: errors.New("nope")}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return recordingMiddleware{name: name, calls: &calls}
+	}
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithMiddleware(mw("router")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := r.Group("/api", mw("group"))
+	v1 := api.Group("/v1", mw("nested-group"))
+
+	err = v1.Register(http.MethodPost, "/echo", func(ctx context.Context, in struct{ Name string }) map[string]string {
+		return map[string]string{"name": in.Name}
+	}, WithRouteMiddleware(mw("route")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/echo", strings.NewReader(`{"Name": "test"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d got %d", http.StatusOK, w.Code)
+	}
+
+	expected := []string{"router", "group", "nested-group", "route"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v got %v", expected, calls)
+	}
+}
+
+func TestMiddlewareErrors(t *testing.T) {
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var called bool
+	err = r.Register(http.MethodPost, "/fn", func(ctx context.Context) {
+		called = true
+	}, WithRouteMiddleware(rejectingMiddleware{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodGet, "/raw", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}), WithRouteMiddleware(NewBasicAuthMiddleware("user", "pass")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name         string
+		Method       string
+		Path         string
+		ExpectStatus int
+	}{
+		{"handler", http.MethodPost, "/fn", http.StatusUnauthorized},
+		{"raw-handler", http.MethodGet, "/raw", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			called = false
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(c.Method, c.Path, strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != c.ExpectStatus {
+				t.Errorf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+
+			if called {
+				t.Error("route should not have been called")
+			}
+		})
+	}
+}
+
+func TestMiddlewareCoversOptionRoutes(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Options []RouterOption
+		Method  string
+		Path    string
+	}{
+		{"metrics", []RouterOption{WithMetricsRoute("/metrics", NewPrometheusCollector())}, http.MethodGet, "/metrics"},
+		{"csp-report", []RouterOption{WithContentSecurityPolicy(NewContentSecurityPolicy().DefaultSrc(CSPSelf)), WithCSPReportRoute("/csp-report", nil)}, http.MethodPost, "/csp-report"},
+		{"openapi", []RouterOption{WithOpenAPIRoute("/openapi.json", OpenAPIInfo{Title: "test"})}, http.MethodGet, "/openapi.json"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			// the middleware comes after the options registering the route
+			r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), append(c.Options, WithMiddleware(rejectingMiddleware{}))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(c.Method, c.Path, strings.NewReader(`{}`)))
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("expected the route to be rejected by middleware, got %d", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package autohttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/fortytw2/autohttp/internal/msgpack"
+)
+
+const maxMsgpackDecoderInputArgs = 4
+
+// MsgpackDecoder fills the function argument from a MessagePack body
+type MsgpackDecoder struct {
+	MaxBytesToRead        int64
+	DisallowUnknownFields bool
+}
+
+func NewMsgpackDecoder() *MsgpackDecoder {
+	return &MsgpackDecoder{
+		MaxBytesToRead:        DefaultMaxBytesToRead,
+		DisallowUnknownFields: true,
+	}
+}
+
+func (md *MsgpackDecoder) ValidateType(fn interface{}) error {
+	_, err := md.inputsAtIndices(fn)
+	return err
+}
+
+func (md *MsgpackDecoder) inputsAtIndices(fn interface{}) (inputArgs, error) {
+	return findInputArgs(fn, maxMsgpackDecoderInputArgs, isBodyDecodable)
+}
+
+// Decode returns the reflect values needed to call the fn
+// from the *http.Request
+func (md *MsgpackDecoder) Decode(fn interface{}, r *http.Request) ([]reflect.Value, error) {
+	mediaType := requestMediaType(r)
+	if mediaType != "application/msgpack" && mediaType != "application/x-msgpack" && mediaTypeSuffix(mediaType) != "msgpack" {
+		return nil, ErrorWithCode{Err: errors.New("invalid mime type"), StatusCode: http.StatusUnsupportedMediaType}
+	}
+
+	ia, err := md.inputsAtIndices(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	callValues := ia.injectedValues(fn, r)
+	if ia.decodeIdx == uIdx {
+		return callValues, nil
+	}
+
+	b, err := readLimitedBody(r, md.MaxBytesToRead)
+	if err != nil {
+		return nil, err
+	}
+
+	inArg := reflect.ValueOf(fn).Type().In(ia.decodeIdx)
+	object := newDecodeTarget(inArg)
+
+	opts := msgpack.UnmarshalOptions{DisallowUnknownFields: md.DisallowUnknownFields}
+	err = opts.Unmarshal(b, object.Interface())
+	if err != nil {
+		return nil, ErrorWithCode{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	callValues[ia.decodeIdx] = decodeTargetValue(inArg, object)
+
+	return callValues, nil
+}
+
+// readLimitedBody reads the entire request body, failing with a 413 if it is
+// larger than max bytes
+func readLimitedBody(r *http.Request, max int64) ([]byte, error) {
+	body := &limitedBody{r: r.Body, n: max}
+	b, err := io.ReadAll(body)
+	if body.exceeded {
+		return nil, ErrorWithCode{Err: fmt.Errorf("maximum body size exceeded (%d bytes)", max), StatusCode: http.StatusRequestEntityTooLarge}
+	}
+
+	if err != nil {
+		return nil, ErrorWithCode{Err: err, StatusCode: http.StatusBadRequest}
+	}
+
+	return b, nil
+}
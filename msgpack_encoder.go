@@ -0,0 +1,48 @@
+package autohttp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/fortytw2/autohttp/internal/msgpack"
+)
+
+// MsgpackEncoder encodes values as MessagePack. Struct fields are named by
+// the `msgpack` tag, falling back to the `json` tag
+type MsgpackEncoder struct{}
+
+func (me *MsgpackEncoder) ValidateType(fn interface{}) error {
+	rt := encodableReturnType(fn)
+	if rt == nil {
+		return nil
+	}
+
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch rt.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return fmt.Errorf("msgpack encoder cannot encode %s", rt)
+	}
+
+	return nil
+}
+
+func (me *MsgpackEncoder) MediaType() string {
+	return "application/msgpack"
+}
+
+func (me *MsgpackEncoder) Encode(value interface{}, hw HeaderWriter) (int, io.Reader, error) {
+	hw("Content-Type", "application/msgpack")
+
+	b, err := msgpack.Marshal(value)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, bytes.NewReader(b), nil
+}
@@ -0,0 +1,192 @@
+package autohttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A MediaTypeEncoder is an Encoder that produces a single media type,
+// allowing it to take part in content negotiation
+type MediaTypeEncoder interface {
+	Encoder
+	MediaType() string
+}
+
+// A RequestEncoder is an Encoder that needs to see the incoming request,
+// such as to read the Accept header. Handler uses EncodeRequest in place of
+// Encode when it is implemented
+type RequestEncoder interface {
+	Encoder
+	EncodeRequest(r *http.Request, value interface{}, hw HeaderWriter) (int, io.Reader, error)
+}
+
+// NegotiatingEncoder picks one of several encoders for each request based on
+// the Accept header. When the client has no preference, the first encoder is
+// used. A function must be compatible with every encoder in the set
+type NegotiatingEncoder struct {
+	encoders []MediaTypeEncoder
+}
+
+func NewNegotiatingEncoder(encoders ...MediaTypeEncoder) *NegotiatingEncoder {
+	return &NegotiatingEncoder{encoders: encoders}
+}
+
+func (ne *NegotiatingEncoder) ValidateType(fn interface{}) error {
+	if len(ne.encoders) == 0 {
+		return errors.New("negotiating encoder needs at least one encoder")
+	}
+
+	for _, e := range ne.encoders {
+		err := e.ValidateType(fn)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.MediaType(), err)
+		}
+	}
+
+	return nil
+}
+
+func (ne *NegotiatingEncoder) Encode(value interface{}, hw HeaderWriter) (int, io.Reader, error) {
+	return ne.encoders[0].Encode(value, hw)
+}
+
+func (ne *NegotiatingEncoder) EncodeRequest(r *http.Request, value interface{}, hw HeaderWriter) (int, io.Reader, error) {
+	hw("Vary", "Accept")
+
+	e := ne.negotiate(r.Header.Values("Accept"))
+	if e == nil {
+		return http.StatusNotAcceptable, nil, ErrorWithCode{
+			Err:        fmt.Errorf("no acceptable representation, available: %s", strings.Join(ne.mediaTypes(), ", ")),
+			StatusCode: http.StatusNotAcceptable,
+		}
+	}
+
+	return e.Encode(value, hw)
+}
+
+func (ne *NegotiatingEncoder) mediaTypes() []string {
+	mts := make([]string, len(ne.encoders))
+	for i, e := range ne.encoders {
+		mts[i] = e.MediaType()
+	}
+
+	return mts
+}
+
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// specificity ranks */* below type/* below type/subtype
+func (mr mediaRange) specificity() int {
+	switch {
+	case mr.typ == "*":
+		return 0
+	case mr.subtype == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (mr mediaRange) matches(typ, subtype string) bool {
+	return (mr.typ == "*" || mr.typ == typ) && (mr.subtype == "*" || mr.subtype == subtype)
+}
+
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			mt, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				// tolerate a bare * sent by some clients
+				if strings.HasPrefix(part, "*") {
+					mt = "*/*"
+				} else {
+					continue
+				}
+			}
+
+			typ, subtype := mt, "*"
+			if idx := strings.IndexByte(mt, '/'); idx != -1 {
+				typ, subtype = mt[:idx], mt[idx+1:]
+			}
+
+			q := 1.0
+			if qs, ok := params["q"]; ok {
+				parsed, err := strconv.ParseFloat(qs, 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					continue
+				}
+				q = parsed
+			}
+
+			ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+		}
+	}
+
+	return ranges
+}
+
+// negotiate returns the encoder with the highest q-value, preferring
+// earlier encoders on ties, or nil if none are acceptable
+func (ne *NegotiatingEncoder) negotiate(accept []string) MediaTypeEncoder {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return ne.encoders[0]
+	}
+
+	var best MediaTypeEncoder
+	var bestQ float64
+	for _, e := range ne.encoders {
+		mt, _, err := mime.ParseMediaType(e.MediaType())
+		if err != nil {
+			continue
+		}
+
+		typ, subtype := mt, ""
+		if idx := strings.IndexByte(mt, '/'); idx != -1 {
+			typ, subtype = mt[:idx], mt[idx+1:]
+		}
+
+		// the most specific matching range decides the q-value
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			if mr.matches(typ, subtype) && mr.specificity() > specificity {
+				q, specificity = mr.q, mr.specificity()
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+// encodableReturnType returns the non-error return type of fn, or nil if
+// fn only returns an error, a Response envelope or nothing at all
+func encodableReturnType(fn interface{}) reflect.Type {
+	fnType := reflect.ValueOf(fn).Type()
+	for i := 0; i < fnType.NumOut(); i++ {
+		out := fnType.Out(i)
+		if !isErrorType(out) && !isResponseType(out) {
+			return out
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package autohttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+type exportRow struct {
+	Name  string `json:"name" csv:"name" xml:"name"`
+	Count int    `json:"count" csv:"count" xml:"count"`
+}
+
+func newTestNegotiatingEncoder() *NegotiatingEncoder {
+	return NewNegotiatingEncoder(&JSONEncoder{}, &XMLEncoder{}, &MsgpackEncoder{}, &CSVEncoder{}, &TextEncoder{})
+}
+
+func TestNegotiatingEncoderValidation(t *testing.T) {
+	t.Parallel()
+
+	ne := newTestNegotiatingEncoder()
+
+	cases := []struct {
+		Name      string
+		Fn        interface{}
+		ShouldErr bool
+	}{
+		{"slice-of-structs", func() []exportRow { return nil }, false},
+		{"slice-of-pointers", func() ([]*exportRow, error) { return nil, nil }, false},
+		{"map", func() map[string]string { return nil }, true},
+		{"no-return", func() error { return nil }, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := ne.ValidateType(c.Fn)
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
+
+func TestMsgpackEncoderValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name      string
+		Fn        interface{}
+		ShouldErr bool
+	}{
+		{"struct", func() (*exportRow, error) { return nil, nil }, false},
+		{"map", func() map[string]int { return nil }, false},
+		{"chan", func() chan int { return nil }, true},
+		{"func", func() (*func(), error) { return nil, nil }, true},
+		{"complex", func() complex128 { return 0 }, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := (&MsgpackEncoder{}).ValidateType(c.Fn)
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
+
+func TestNegotiatingEncoder(t *testing.T) {
+	fn := func() []exportRow {
+		return []exportRow{{Name: "a", Count: 1}, {Name: "b,c", Count: 2}}
+	}
+
+	cases := []struct {
+		Name         string
+		Accept       string
+		ExpectStatus int
+		ExpectType   string
+		ExpectBody   string
+	}{
+		{"no-accept", "", http.StatusOK, "application/json", `[{"name":"a","count":1},{"name":"b,c","count":2}]`},
+		{"wildcard", "*/*", http.StatusOK, "application/json", ""},
+		{"csv", "text/csv", http.StatusOK, "text/csv; charset=utf-8", "name,count\na,1\n\"b,c\",2"},
+		{"xml", "application/xml", http.StatusOK, "application/xml; charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n<items><exportRow><name>a</name><count>1</count></exportRow><exportRow><name>b,c</name><count>2</count></exportRow></items>"},
+		{"msgpack", "application/msgpack", http.StatusOK, "application/msgpack", ""},
+		{"q-values", "application/json;q=0.5, text/csv;q=0.9", http.StatusOK, "text/csv; charset=utf-8", ""},
+		{"type-wildcard", "text/*", http.StatusOK, "text/csv; charset=utf-8", ""},
+		{"specific-beats-wildcard", "text/*;q=0.9, text/csv;q=0.1, text/plain", http.StatusOK, "text/plain; charset=utf-8", ""},
+		{"excluded", "application/json;q=0, */*;q=0.1", http.StatusOK, "application/xml; charset=utf-8", ""},
+		{"not-acceptable", "image/png", http.StatusNotAcceptable, "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NoOpDecoder{}, newTestNegotiatingEncoder(), DefaultErrorHandler, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.Accept != "" {
+				r.Header.Set("Accept", c.Accept)
+			}
+
+			ar.ServeHTTP(w, r)
+
+			if w.Code != c.ExpectStatus {
+				t.Fatalf("expected %d got %d: %s", c.ExpectStatus, w.Code, w.Body.String())
+			}
+
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("expected Vary: Accept, got %q", w.Header().Get("Vary"))
+			}
+
+			if c.ExpectType != "" && w.Header().Get("Content-Type") != c.ExpectType {
+				t.Errorf("expected content type %q got %q", c.ExpectType, w.Header().Get("Content-Type"))
+			}
+
+			if c.ExpectBody != "" && strings.TrimSpace(w.Body.String()) != c.ExpectBody {
+				t.Errorf("expected body %q got %q", c.ExpectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCSVEncoderEmpty(t *testing.T) {
+	var nilRows *[]exportRow
+	cases := []struct {
+		Name       string
+		Value      interface{}
+		ExpectBody string
+	}{
+		{"nil-slice", []exportRow(nil), "name,count"},
+		{"nil-pointer-to-slice", nilRows, "name,count"},
+		{"pointer-to-slice", &[]exportRow{{Name: "a", Count: 1}}, "name,count\na,1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			code, body, err := (&CSVEncoder{}).Encode(c.Value, func(key, val string) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if code != http.StatusOK {
+				t.Errorf("expected 200 got %d", code)
+			}
+
+			var b strings.Builder
+			io.Copy(&b, body)
+			if strings.TrimSpace(b.String()) != c.ExpectBody {
+				t.Errorf("expected body %q got %q", c.ExpectBody, b.String())
+			}
+		})
+	}
+}
@@ -23,14 +23,23 @@ func (noop NoOpDecoder) Decode(fn interface{}, r *http.Request) ([]reflect.Value
 
 type NoOpEncoder struct{}
 
+// ValidateType allows functions with no return values, or that only return a
+// Response envelope without a Body to set the status code and headers
 func (noop NoOpEncoder) ValidateType(fn interface{}) error {
-	if reflect.ValueOf(fn).Type().NumOut() != 0 {
-		return errors.New("noop encoder only works for functions with no return values")
+	fnType := reflect.ValueOf(fn).Type()
+	for i := 0; i < fnType.NumOut(); i++ {
+		if !isResponseType(fnType.Out(i)) {
+			return errors.New("noop encoder only works for functions with no return values")
+		}
 	}
 
 	return nil
 }
 
 func (noop NoOpEncoder) Encode(value interface{}, hw HeaderWriter) (int, io.Reader, error) {
+	if value != nil {
+		return http.StatusInternalServerError, nil, errors.New("noop encoder cannot encode a response body")
+	}
+
 	return http.StatusNoContent, nil, nil
 }
@@ -0,0 +1,302 @@
+package autohttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification generated
+const OpenAPIVersion = "3.1.0"
+
+// wildcardParamName names the anonymous catch-all of a /path/* pattern,
+// which has no name of its own
+const wildcardParamName = "wildcard"
+
+// openAPIMethods are the methods a path item can describe, extension
+// methods registered through WithMethods are left out
+var openAPIMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodPut:     true,
+	http.MethodPost:    true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodHead:    true,
+	http.MethodPatch:   true,
+	http.MethodTrace:   true,
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 description of a Router
+type OpenAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       OpenAPIInfo                `json:"info"`
+	Paths      map[string]OpenAPIPathItem `json:"paths"`
+	Components *OpenAPIComponents         `json:"components,omitempty"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIPathItem holds the operations of a path, keyed by lowercase method
+type OpenAPIPathItem map[string]*OpenAPIOperation
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *JSONSchema `json:"schema"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*JSONSchema `json:"schemas,omitempty"`
+}
+
+// WithOpenAPIRoute serves the Router's OpenAPI document as JSON at path.
+// The document is generated on each request, so it covers routes
+// registered after the Router is created
+func WithOpenAPIRoute(path string, info OpenAPIInfo) func(r *Router) error {
+	return func(r *Router) error {
+		r.registerAfterOptions(http.MethodGet, path, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(r.OpenAPI(info))
+			if err != nil {
+				r.log.Errorf("could not write openapi document: %s", err)
+			}
+		}))
+		return nil
+	}
+}
+
+// OpenAPI describes every function route registered on the Router.
+// Schemas are reflected from each function's decoded argument and return
+// value, using json tags for names and validate tags for constraints.
+// Raw http.Handlers and routes registered with HideFromIntrospectors
+// are left out
+func (r *Router) OpenAPI(info OpenAPIInfo) *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]OpenAPIPathItem),
+	}
+
+	sg := newSchemaGenerator()
+	for _, route := range r.introspectRoutes() {
+		if !openAPIMethods[route.method] {
+			continue
+		}
+
+		path, params := openAPIPath(route.pattern)
+
+		op := &OpenAPIOperation{
+			OperationID: route.name,
+			Parameters:  params,
+			Responses:   make(map[string]*OpenAPIResponse),
+		}
+
+		if t := route.decodeType(); t != nil {
+			op.Parameters = append(op.Parameters, sg.queryParameters(route.handler.decoder, t)...)
+			if content := sg.requestContent(route.handler.decoder, t); len(content) > 0 {
+				op.RequestBody = &OpenAPIRequestBody{Required: true, Content: content}
+			}
+		}
+
+		// a Response envelope picks its status code at runtime
+		resp := route.response()
+		code, description := "2XX", "Success"
+		if resp.status != 0 {
+			code, description = strconv.Itoa(resp.status), http.StatusText(resp.status)
+		}
+
+		op.Responses[code] = &OpenAPIResponse{Description: description}
+		if resp.body != nil {
+			op.Responses[code].Content = sg.responseContent(route.handler.encoder, resp.body)
+		}
+		op.Responses["default"] = &OpenAPIResponse{Description: "Error"}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(OpenAPIPathItem)
+		}
+		doc.Paths[path][strings.ToLower(route.method)] = op
+	}
+
+	if len(sg.components) > 0 {
+		doc.Components = &OpenAPIComponents{Schemas: sg.components}
+	}
+
+	return doc
+}
+
+// openAPIPath converts a route pattern into an OpenAPI path template
+// and its path parameters
+func openAPIPath(pattern string) (string, []OpenAPIParameter) {
+	tokens, err := parsePattern(pattern)
+	if err != nil {
+		return pattern, nil
+	}
+
+	var (
+		path   strings.Builder
+		params []OpenAPIParameter
+	)
+	for _, tok := range tokens {
+		if tok.param == "" {
+			path.WriteString(tok.static)
+			continue
+		}
+
+		name := tok.param
+		if name == anonymousCatchAll {
+			name = wildcardParamName
+		}
+
+		path.WriteString("{" + name + "}")
+		params = append(params, OpenAPIParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &JSONSchema{Type: "string"},
+		})
+	}
+
+	return path.String(), params
+}
+
+// queryParameters lists the query string parameters read by a QueryDecoder
+func (sg *schemaGenerator) queryParameters(d Decoder, t reflect.Type) []OpenAPIParameter {
+	if _, ok := d.(*QueryDecoder); !ok {
+		return nil
+	}
+
+	vs, err := compileValuesStruct(t, "query")
+	if err != nil {
+		return nil
+	}
+
+	st := t
+	for st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+
+	var params []OpenAPIParameter
+	for _, f := range vs.fields {
+		schema, required := sg.valuesFieldSchema(st, f)
+		params = append(params, OpenAPIParameter{
+			Name:     f.key,
+			In:       "query",
+			Required: required,
+			Schema:   schema,
+		})
+	}
+
+	return params
+}
+
+func (sg *schemaGenerator) valuesFieldSchema(st reflect.Type, f valuesField) (*JSONSchema, bool) {
+	schema := sg.schemaFor(f.typ)
+	sf := st.FieldByIndex(f.index)
+	if doc := sf.Tag.Get("doc"); doc != "" {
+		schema.Description = doc
+	}
+
+	return schema, applyValidateTag(schema, sf)
+}
+
+// requestContent describes the request body read by d, keyed by media type
+func (sg *schemaGenerator) requestContent(d Decoder, t reflect.Type) map[string]OpenAPIMediaType {
+	switch dec := d.(type) {
+	case *JSONDecoder:
+		return map[string]OpenAPIMediaType{"application/json": {Schema: sg.rootSchema(t)}}
+	case *MsgpackDecoder:
+		return map[string]OpenAPIMediaType{"application/msgpack": {Schema: sg.rootSchema(t)}}
+	case *BinaryDecoder:
+		return map[string]OpenAPIMediaType{"application/octet-stream": {Schema: &JSONSchema{Type: "string", Format: "binary"}}}
+	case *FormDecoder:
+		return sg.formContent(t)
+	case *ContentTypeDecoder:
+		content := make(map[string]OpenAPIMediaType)
+		for _, mt := range dec.mediaTypes() {
+			for _, mediaType := range sg.requestContent(dec.decoders[mt], t) {
+				content[mt] = mediaType
+			}
+		}
+		return content
+	}
+
+	return nil
+}
+
+func (sg *schemaGenerator) formContent(t reflect.Type) map[string]OpenAPIMediaType {
+	vs, err := compileValuesStruct(t, "form")
+	if err != nil {
+		return nil
+	}
+
+	st := t
+	for st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+
+	schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+	for _, f := range append(append([]valuesField{}, vs.fields...), vs.files...) {
+		fieldSchema, required := sg.valuesFieldSchema(st, f)
+		schema.Properties[f.key] = fieldSchema
+		if required {
+			schema.Required = append(schema.Required, f.key)
+		}
+	}
+
+	mediaType := "application/x-www-form-urlencoded"
+	if len(vs.files) > 0 {
+		mediaType = "multipart/form-data"
+	}
+
+	return map[string]OpenAPIMediaType{mediaType: {Schema: schema}}
+}
+
+// responseContent describes the body written by e, keyed by media type
+func (sg *schemaGenerator) responseContent(e Encoder, t reflect.Type) map[string]OpenAPIMediaType {
+	switch enc := e.(type) {
+	case *NegotiatingEncoder:
+		content := make(map[string]OpenAPIMediaType)
+		for _, sub := range enc.encoders {
+			for mt, mediaType := range sg.responseContent(sub, t) {
+				content[mt] = mediaType
+			}
+		}
+		return content
+	case *TextEncoder:
+		return map[string]OpenAPIMediaType{enc.MediaType(): {Schema: &JSONSchema{Type: "string"}}}
+	case *CSVEncoder:
+		return map[string]OpenAPIMediaType{enc.MediaType(): {Schema: &JSONSchema{Type: "string"}}}
+	case MediaTypeEncoder:
+		return map[string]OpenAPIMediaType{enc.MediaType(): {Schema: sg.rootSchema(t)}}
+	}
+
+	return nil
+}
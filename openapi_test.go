@@ -0,0 +1,189 @@
+package autohttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+type openAPIAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type openAPIUser struct {
+	Name      string          `json:"name" validate:"required,min=2,max=64"`
+	Email     string          `json:"email,omitempty" validate:"email"`
+	Role      string          `json:"role" validate:"oneof=admin member"`
+	Age       *int            `json:"age"`
+	Address   *openAPIAddress `json:"address"`
+	Friends   []*openAPIUser  `json:"friends"`
+	CreatedAt time.Time       `json:"created_at"`
+	internal  string
+}
+
+type openAPISearch struct {
+	Query string `query:"q" validate:"required"`
+	Page  int    `query:"page"`
+}
+
+func createOpenAPIUser(ctx context.Context, u *openAPIUser) (*openAPIUser, error) {
+	return u, nil
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	log := lounge.NewDefaultLog(lounge.WithOutput(os.Stderr))
+	r, err := NewRouter(log, WithOpenAPIRoute("/openapi.json", OpenAPIInfo{Title: "test", Version: "1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := []struct {
+		method string
+		path   string
+		fn     interface{}
+		opts   []RouteOption
+	}{
+		{http.MethodPost, "/users", createOpenAPIUser, nil},
+		{http.MethodGet, "/users/{id}", func(ctx context.Context, p PathParams) (*openAPIUser, error) {
+			return nil, nil
+		}, []RouteOption{WithRouteName("getUser")}},
+		{http.MethodGet, "/search", func(ctx context.Context, s *openAPISearch) ([]openAPIUser, error) {
+			return nil, nil
+		}, []RouteOption{WithRouteDecoder(NewQueryDecoder())}},
+		{http.MethodDelete, "/users/{id}", func(ctx context.Context, p PathParams) error {
+			return nil
+		}, nil},
+		{http.MethodPost, "/created", func(ctx context.Context) (createdUser, error) {
+			return createdUser{}, nil
+		}, nil},
+		{http.MethodPost, "/envelope", func(ctx context.Context) (*Response, error) {
+			return nil, nil
+		}, nil},
+		{http.MethodGet, "/internal", func(ctx context.Context) (string, error) {
+			return "", nil
+		}, []RouteOption{HideFromIntrospectors}},
+	}
+
+	for _, rt := range routes {
+		err := r.Register(rt.method, rt.path, rt.fn, rt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+
+	var doc OpenAPIDocument
+	err = json.Unmarshal(w.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != OpenAPIVersion {
+		t.Errorf("expected version %s got %s", OpenAPIVersion, doc.OpenAPI)
+	}
+
+	if _, ok := doc.Paths["/internal"]; ok {
+		t.Error("hidden route was documented")
+	}
+
+	if _, ok := doc.Paths["/openapi.json"]; ok {
+		t.Error("raw handler was documented")
+	}
+
+	create := doc.Paths["/users"]["post"]
+	if create == nil || create.OperationID != "createOpenAPIUser" {
+		t.Fatalf("unexpected create operation %+v", create)
+	}
+
+	body := create.RequestBody.Content["application/json"].Schema
+	if body.Ref != "#/components/schemas/openAPIUser" {
+		t.Errorf("unexpected request schema %+v", body)
+	}
+
+	if create.Responses["200"].Content["application/json"].Schema.Ref == "" {
+		t.Error("expected a response schema")
+	}
+
+	get := doc.Paths["/users/{id}"]["get"]
+	if get.OperationID != "getUser" {
+		t.Errorf("expected getUser got %s", get.OperationID)
+	}
+
+	if len(get.Parameters) != 1 || get.Parameters[0].In != "path" || get.Parameters[0].Name != "id" {
+		t.Errorf("unexpected params %+v", get.Parameters)
+	}
+
+	if _, ok := doc.Paths["/users/{id}"]["delete"].Responses["204"]; !ok {
+		t.Error("expected a 204 response for a route without a body")
+	}
+
+	created := doc.Paths["/created"]["post"].Responses
+	if created["201"] == nil || created["201"].Content["application/json"].Schema.Ref != "#/components/schemas/createdUser" {
+		t.Errorf("expected a 201 response from the StatusCoder, got %+v", created)
+	}
+
+	envelope := doc.Paths["/envelope"]["post"].Responses
+	if envelope["2XX"] == nil || len(envelope["2XX"].Content) == 0 {
+		t.Errorf("expected a 2XX response with a body for a Response envelope, got %+v", envelope)
+	}
+
+	search := doc.Paths["/search"]["get"]
+	if search.RequestBody != nil {
+		t.Error("query decoder should not document a body")
+	}
+
+	if len(search.Parameters) != 2 || search.Parameters[0].Name != "q" || !search.Parameters[0].Required || search.Parameters[0].In != "query" {
+		t.Errorf("unexpected query params %+v", search.Parameters)
+	}
+
+	user := doc.Components.Schemas["openAPIUser"]
+	if user == nil {
+		t.Fatal("expected openAPIUser component")
+	}
+
+	if !reflect.DeepEqual(user.Required, []string{"name"}) {
+		t.Errorf("unexpected required %v", user.Required)
+	}
+
+	if _, ok := user.Properties["internal"]; ok {
+		t.Error("unexported field documented")
+	}
+
+	name := user.Properties["name"]
+	if *name.MinLength != 2 || *name.MaxLength != 64 {
+		t.Errorf("unexpected name bounds %+v", name)
+	}
+
+	if user.Properties["email"].Format != "email" || len(user.Properties["role"].Enum) != 2 {
+		t.Error("expected email format and role enum")
+	}
+
+	if user.Properties["created_at"].Format != "date-time" {
+		t.Error("expected date-time format")
+	}
+
+	if !reflect.DeepEqual(user.Properties["age"].Type, []interface{}{"integer", "null"}) {
+		t.Errorf("expected nullable integer got %v", user.Properties["age"].Type)
+	}
+
+	if len(user.Properties["address"].AnyOf) != 2 {
+		t.Errorf("expected nullable ref got %+v", user.Properties["address"])
+	}
+
+	if user.Properties["friends"].Items.AnyOf[0].Ref != "#/components/schemas/openAPIUser" {
+		t.Error("expected recursive ref")
+	}
+}
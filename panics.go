@@ -0,0 +1,92 @@
+package autohttp
+
+import (
+	"io"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/fortytw2/autohttp/internal/httpsnoop"
+	"github.com/fortytw2/lounge"
+)
+
+// PanicError is the error passed to the ErrorHandler when a route panics.
+// It is always reported with a 500 status code. Value and Stack are only
+// meant for logs and the PanicHook, so Error never includes them
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (pe *PanicError) Error() string {
+	return "internal server error"
+}
+
+// A PanicHook is called with every recovered panic, such as to report
+// it to an error tracking service
+type PanicHook func(r *http.Request, pe *PanicError)
+
+// trackWrites wraps w to record whether the status line has been sent
+func trackWrites(w http.ResponseWriter) (http.ResponseWriter, *bool) {
+	wrote := new(bool)
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				*wrote = true
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				*wrote = true
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				*wrote = true
+				return next(src)
+			}
+		},
+	}), wrote
+}
+
+// handlePanic reports a recovered panic and responds with a 500 if nothing
+// has been written yet. Otherwise the response is already underway, so the
+// connection is aborted to signal the failure to the client
+func handlePanic(w http.ResponseWriter, r *http.Request, rec interface{}, wroteHeader bool, log lounge.Log, hook PanicHook, errorHandler ErrorHandler) {
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+
+	pe := &PanicError{Value: rec, Stack: debug.Stack()}
+	log.Errorf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, pe.Stack)
+
+	if hook != nil {
+		hook(r, pe)
+	}
+
+	if wroteHeader {
+		panic(http.ErrAbortHandler)
+	}
+
+	errorHandler(w, r, pe)
+}
+
+// recoveryHandler adds panic recovery to a plain http.Handler
+type recoveryHandler struct {
+	next         http.Handler
+	log          lounge.Log
+	hook         PanicHook
+	errorHandler ErrorHandler
+}
+
+func (rh *recoveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, wrote := trackWrites(w)
+	defer func() {
+		if rec := recover(); rec != nil {
+			handlePanic(w, r, rec, *wrote, rh.log, rh.hook, rh.errorHandler)
+		}
+	}()
+
+	rh.next.ServeHTTP(w, r)
+}
@@ -0,0 +1,115 @@
+package autohttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	var hooked *PanicError
+	r, err := NewRouter(
+		lounge.NewDefaultLog(lounge.WithOutput(io.Discard)),
+		WithPanicHook(func(r *http.Request, pe *PanicError) {
+			hooked = pe
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/fn", func(ctx context.Context) map[string]string {
+		panic("kaboom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/debug", func(ctx context.Context) map[string]string {
+		panic("debug kaboom")
+	}, WithRouteErrorHandler(DebugProblemErrorHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodGet, "/raw", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("raw kaboom")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodGet, "/static/*", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("wildcard kaboom")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodGet, "/streaming", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("mid-stream kaboom")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name        string
+		Method      string
+		Path        string
+		ExpectValue string
+		ExpectBody  string
+	}{
+		{"handler", http.MethodPost, "/fn", "kaboom", `{"error":"Internal Server Error"}`},
+		{"debug-problem", http.MethodPost, "/debug", "debug kaboom", `{"detail":"internal server error","instance":"/debug","status":500,"title":"Internal Server Error","type":"about:blank"}`},
+		{"raw-handler", http.MethodGet, "/raw", "raw kaboom", `{"error":"Internal Server Error"}`},
+		{"wildcard", http.MethodGet, "/static/app.js", "wildcard kaboom", `{"error":"Internal Server Error"}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			hooked = nil
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(c.Method, c.Path, strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("expected %d got %d", http.StatusInternalServerError, w.Code)
+			}
+
+			if body := strings.TrimSpace(w.Body.String()); body != c.ExpectBody {
+				t.Errorf("expected body %s got %s", c.ExpectBody, body)
+			}
+
+			if hooked == nil || hooked.Value != c.ExpectValue {
+				t.Fatalf("panic hook not called with %q: %+v", c.ExpectValue, hooked)
+			}
+
+			if !strings.Contains(string(hooked.Stack), "panics_test.go") {
+				t.Error("stack trace does not include the panicking function")
+			}
+		})
+	}
+
+	t.Run("headers-already-sent", func(t *testing.T) {
+		defer func() {
+			rec := recover()
+			if rec != http.ErrAbortHandler {
+				t.Errorf("expected http.ErrAbortHandler, got %v", rec)
+			}
+		}()
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/streaming", nil))
+		t.Error("ServeHTTP should have aborted")
+	})
+}
@@ -0,0 +1,119 @@
+package autohttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Problem is an RFC 7807 problem details object. A function can return a
+// *Problem as its error to control every member of the response
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+
+	// Extensions are additional members written alongside the standard ones
+	Extensions map[string]interface{}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+
+	return p.Title
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+
+	return json.Marshal(members)
+}
+
+// ProblemErrorHandler writes errors as application/problem+json.
+// The detail of a 5xx error is replaced with a generic message so internal
+// errors are not leaked to clients; use DebugProblemErrorHandler to see them.
+// FieldErrors from decoding or validation are listed under "errors"
+func ProblemErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, err, false)
+}
+
+// DebugProblemErrorHandler is a ProblemErrorHandler that includes the detail
+// of every error, for use in development
+func DebugProblemErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, err, true)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, err error, debug bool) {
+	p := problemFor(err, debug)
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func problemFor(err error, debug bool) *Problem {
+	var given *Problem
+	if errors.As(err, &given) {
+		p := *given
+		if p.Status == 0 {
+			p.Status = http.StatusInternalServerError
+		}
+		if p.Type == "" {
+			p.Type = "about:blank"
+		}
+		if p.Title == "" {
+			p.Title = http.StatusText(p.Status)
+		}
+
+		return &p
+	}
+
+	status := statusCodeFor(err)
+	p := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+
+	p.Detail = errorDetail(err, status, debug)
+
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		p.Extensions = map[string]interface{}{"errors": fieldErrs}
+		if status < http.StatusInternalServerError {
+			p.Detail = "one or more fields are invalid"
+		}
+	}
+
+	return p
+}
+
+// errorDetail is the message of err that is safe to show a client, which
+// is empty for 5xx errors unless debug is set
+func errorDetail(err error, status int, debug bool) string {
+	if status >= http.StatusInternalServerError && !debug {
+		return ""
+	}
+
+	return err.Error()
+}
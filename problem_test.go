@@ -0,0 +1,118 @@
+package autohttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestProblemErrorHandler(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name    string
+		Handler ErrorHandler
+		Err     error
+		Expect  map[string]interface{}
+	}{
+		{
+			"internal-hidden",
+			ProblemErrorHandler,
+			errors.New("pq: connection refused"),
+			map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Internal Server Error",
+				"status":   float64(500),
+				"instance": "/users/42",
+			},
+		},
+		{
+			"internal-debug",
+			DebugProblemErrorHandler,
+			errors.New("pq: connection refused"),
+			map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Internal Server Error",
+				"status":   float64(500),
+				"detail":   "pq: connection refused",
+				"instance": "/users/42",
+			},
+		},
+		{
+			"client-error",
+			ProblemErrorHandler,
+			ErrorWithCode{Err: errors.New("user is locked"), StatusCode: http.StatusConflict},
+			map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Conflict",
+				"status":   float64(409),
+				"detail":   "user is locked",
+				"instance": "/users/42",
+			},
+		},
+		{
+			"field-errors",
+			ProblemErrorHandler,
+			ErrorWithCode{Err: FieldErrors{{Field: "limit", Message: "invalid integer \"x\""}}, StatusCode: http.StatusBadRequest},
+			map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Bad Request",
+				"status":   float64(400),
+				"detail":   "one or more fields are invalid",
+				"instance": "/users/42",
+				"errors": []interface{}{
+					map[string]interface{}{"field": "limit", "message": "invalid integer \"x\""},
+				},
+			},
+		},
+		{
+			"custom-problem",
+			ProblemErrorHandler,
+			&Problem{
+				Type:       "https://example.com/probs/out-of-credit",
+				Status:     http.StatusForbidden,
+				Detail:     "balance is 30, cost is 50",
+				Instance:   "/account/12345/msgs/abc",
+				Extensions: map[string]interface{}{"balance": 30},
+			},
+			map[string]interface{}{
+				"type":     "https://example.com/probs/out-of-credit",
+				"title":    "Forbidden",
+				"status":   float64(403),
+				"detail":   "balance is 30, cost is 50",
+				"instance": "/account/12345/msgs/abc",
+				"balance":  float64(30),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+
+			c.Handler(w, r, c.Err)
+
+			if w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+			}
+
+			if w.Code != int(c.Expect["status"].(float64)) {
+				t.Errorf("expected status %v got %d", c.Expect["status"], w.Code)
+			}
+
+			var got map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, c.Expect) {
+				t.Errorf("expected %v got %v", c.Expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package autohttp
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMetricsBuckets are the upper bounds, in seconds, of the latency
+// histograms kept by a PrometheusCollector
+var DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// prometheusContentType is the version of the text exposition format written
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metricLabels struct {
+	method, route, status, phase string
+}
+
+// String formats the labels for the exposition format. The route is empty
+// for requests that matched no route
+func (ml metricLabels) String() string {
+	s := `method="` + labelEscaper.Replace(ml.method) + `",route="` + labelEscaper.Replace(ml.route) + `"`
+	if ml.status != "" {
+		s += `,status="` + ml.status + `"`
+	}
+
+	if ml.phase != "" {
+		s += `,phase="` + ml.phase + `"`
+	}
+
+	return s
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	for i, le := range buckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+// PrometheusCollector is a MetricsCollector that keeps counters and latency
+// histograms in memory, and serves them in the Prometheus text format
+type PrometheusCollector struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	requests  map[metricLabels]uint64
+	bytesIn   map[metricLabels]uint64
+	bytesOut  map[metricLabels]uint64
+	durations map[metricLabels]*histogram
+	phases    map[metricLabels]*histogram
+}
+
+// NewPrometheusCollector keeps latency histograms with the given bucket
+// bounds in seconds, or DefaultMetricsBuckets if none are given
+func NewPrometheusCollector(buckets ...float64) *PrometheusCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	return &PrometheusCollector{
+		buckets:   sorted,
+		requests:  make(map[metricLabels]uint64),
+		bytesIn:   make(map[metricLabels]uint64),
+		bytesOut:  make(map[metricLabels]uint64),
+		durations: make(map[metricLabels]*histogram),
+		phases:    make(map[metricLabels]*histogram),
+	}
+}
+
+// WithMetricsRoute collects metrics with pc, serving them at path
+func WithMetricsRoute(path string, pc *PrometheusCollector) func(r *Router) error {
+	return func(r *Router) error {
+		r.metricsCollectors = append(r.metricsCollectors, pc)
+		r.registerAfterOptions(http.MethodGet, path, pc)
+		return nil
+	}
+}
+
+func (pc *PrometheusCollector) Collect(r *http.Request, m RouteMetrics) {
+	route := metricLabels{method: m.Method, route: m.Pattern}
+	withStatus := route
+	withStatus.status = strconv.Itoa(m.Status)
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.requests[withStatus]++
+	pc.bytesIn[route] += uint64(m.BytesIn)
+	pc.bytesOut[route] += uint64(m.BytesOut)
+	pc.histogram(pc.durations, route).observe(pc.buckets, m.Duration.Seconds())
+
+	// raw http.Handlers have no phases to report
+	if m.Decode == 0 && m.Handler == 0 && m.Encode == 0 {
+		return
+	}
+
+	for phase, d := range map[string]float64{
+		"decode":  m.Decode.Seconds(),
+		"handler": m.Handler.Seconds(),
+		"encode":  m.Encode.Seconds(),
+	} {
+		labels := route
+		labels.phase = phase
+		pc.histogram(pc.phases, labels).observe(pc.buckets, d)
+	}
+}
+
+func (pc *PrometheusCollector) histogram(hs map[metricLabels]*histogram, labels metricLabels) *histogram {
+	h, ok := hs[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(pc.buckets))}
+		hs[labels] = h
+	}
+
+	return h
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format
+func (pc *PrometheusCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	writeCounter(bw, "autohttp_requests_total", "Requests served, by route, method and status.", pc.requests)
+	writeCounter(bw, "autohttp_request_bytes_total", "Bytes read from request bodies.", pc.bytesIn)
+	writeCounter(bw, "autohttp_response_bytes_total", "Bytes written to response bodies.", pc.bytesOut)
+	pc.writeHistogram(bw, "autohttp_request_duration_seconds", "Time taken to serve requests.", pc.durations)
+	pc.writeHistogram(bw, "autohttp_request_phase_duration_seconds", "Time spent decoding, handling and encoding requests.", pc.phases)
+}
+
+func sortedLabels(labels []metricLabels) []metricLabels {
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].String() < labels[j].String()
+	})
+
+	return labels
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func writeCounter(w *bufio.Writer, name, help string, values map[metricLabels]uint64) {
+	writeHeader(w, name, help, "counter")
+
+	labels := make([]metricLabels, 0, len(values))
+	for l := range values {
+		labels = append(labels, l)
+	}
+
+	for _, l := range sortedLabels(labels) {
+		w.WriteString(name + "{" + l.String() + "} " + strconv.FormatUint(values[l], 10) + "\n")
+	}
+}
+
+func (pc *PrometheusCollector) writeHistogram(w *bufio.Writer, name, help string, hs map[metricLabels]*histogram) {
+	writeHeader(w, name, help, "histogram")
+
+	labels := make([]metricLabels, 0, len(hs))
+	for l := range hs {
+		labels = append(labels, l)
+	}
+
+	for _, l := range sortedLabels(labels) {
+		h := hs[l]
+		ls := l.String()
+
+		var cumulative uint64
+		for i, le := range pc.buckets {
+			cumulative += h.counts[i]
+			w.WriteString(name + "_bucket{" + ls + `,le="` + formatFloat(le) + `"} ` + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString(name + "_bucket{" + ls + `,le="+Inf"} ` + strconv.FormatUint(h.count, 10) + "\n")
+		w.WriteString(name + "_sum{" + ls + "} " + formatFloat(h.sum) + "\n")
+		w.WriteString(name + "_count{" + ls + "} " + strconv.FormatUint(h.count, 10) + "\n")
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,104 @@
+package autohttp
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+const maxQueryDecoderInputArgs = 4
+
+// QueryDecoder fills the struct argument of a function from the URL query
+// string, making it suitable for GET endpoints.
+//
+// Fields are matched using the `query` struct tag, falling back to the field
+// name. Nested structs use dotted keys (filter.name), slices are filled from
+// repeated keys and pointer fields are left nil when their key is absent
+type QueryDecoder struct {
+	DisallowUnknownFields bool
+}
+
+func NewQueryDecoder() *QueryDecoder {
+	return &QueryDecoder{}
+}
+
+func (qd *QueryDecoder) ValidateType(fn interface{}) error {
+	ia, err := qd.inputsAtIndices(fn)
+	if err != nil {
+		return err
+	}
+
+	if ia.decodeIdx != uIdx {
+		vs, err := compileValuesStruct(reflect.ValueOf(fn).Type().In(ia.decodeIdx), "query")
+		if err != nil {
+			return err
+		}
+
+		if len(vs.files) > 0 {
+			return errors.New("query decoder cannot decode file uploads")
+		}
+	}
+
+	return nil
+}
+
+func (qd *QueryDecoder) inputsAtIndices(fn interface{}) (inputArgs, error) {
+	return findInputArgs(fn, maxQueryDecoderInputArgs, isValuesDecodable)
+}
+
+func isValuesDecodable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct
+}
+
+// Decode returns the reflect values needed to call the fn
+// from the *http.Request
+func (qd *QueryDecoder) Decode(fn interface{}, r *http.Request) ([]reflect.Value, error) {
+	ia, err := qd.inputsAtIndices(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	callValues := ia.injectedValues(fn, r)
+
+	if ia.decodeIdx != uIdx {
+		inArg := reflect.ValueOf(fn).Type().In(ia.decodeIdx)
+
+		vs, err := compileValuesStruct(inArg, "query")
+		if err != nil {
+			return nil, err
+		}
+
+		object := newDecodeTarget(inArg)
+		err = vs.decode(object.Elem(), r.URL.Query(), qd.DisallowUnknownFields)
+		if err != nil {
+			return nil, ErrorWithCode{Err: err, StatusCode: http.StatusBadRequest}
+		}
+
+		callValues[ia.decodeIdx] = decodeTargetValue(inArg, object)
+	}
+
+	return callValues, nil
+}
+
+// newDecodeTarget allocates a new value for an argument of type t, which
+// may be either a struct or a pointer to one
+func newDecodeTarget(t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem())
+	}
+
+	return reflect.New(t)
+}
+
+// decodeTargetValue converts a value from newDecodeTarget back to t
+func decodeTargetValue(t reflect.Type, object reflect.Value) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return object
+	}
+
+	return object.Elem()
+}
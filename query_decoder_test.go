@@ -0,0 +1,202 @@
+package autohttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+type queryFilter struct {
+	Name string `query:"name"`
+	Tags []string
+}
+
+type querySearch struct {
+	Query   string      `query:"q"`
+	Limit   *int        `query:"limit"`
+	Enabled bool        `query:"enabled"`
+	Since   time.Time   `query:"since"`
+	IP      net.IP      `query:"ip"`
+	Scores  []float64   `query:"score"`
+	Filter  queryFilter `query:"filter"`
+	Ignored string      `query:"-"`
+}
+
+func TestQueryDecoderValidation(t *testing.T) {
+	t.Parallel()
+
+	qd := NewQueryDecoder()
+
+	cases := []struct {
+		Name      string
+		Fn        interface{}
+		ShouldErr bool
+	}{
+		{
+			"ctx-only",
+			func(ctx context.Context) {},
+			false,
+		},
+		{
+			"full-args",
+			func(ctx context.Context, h Header, pp PathParams, in querySearch) {},
+			false,
+		},
+		{
+			"pointer-struct",
+			func(in *querySearch) {},
+			false,
+		},
+		{
+			"map-field",
+			func(in struct{ M map[string]string }) {},
+			true,
+		},
+		{
+			"chan-field",
+			func(in struct{ C chan int }) {},
+			true,
+		},
+		{
+			"slice-of-structs",
+			func(in struct{ S []queryFilter }) {},
+			true,
+		},
+		{
+			"duplicate-key",
+			func(in struct {
+				A string `query:"a"`
+				B string `query:"a"`
+			}) {
+			},
+			true,
+		},
+		{
+			"slice-arg",
+			func(in []int) {},
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := qd.ValidateType(c.Fn)
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
+
+func TestQueryDecoder(t *testing.T) {
+	var got querySearch
+	fn := func(ctx context.Context, in querySearch) {
+		got = in
+	}
+
+	limit := 10
+
+	cases := []struct {
+		Name         string
+		Query        string
+		ExpectStatus int
+		Expect       querySearch
+	}{
+		{
+			"empty",
+			"",
+			http.StatusNoContent,
+			querySearch{},
+		},
+		{
+			"full",
+			"q=cats&limit=10&enabled=true&since=2021-12-01&ip=10.0.0.1&score=1.5&score=2&filter.name=bob&filter.Tags=a&filter.Tags=b&Ignored=x",
+			http.StatusNoContent,
+			querySearch{
+				Query:   "cats",
+				Limit:   &limit,
+				Enabled: true,
+				Since:   time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC),
+				IP:      net.ParseIP("10.0.0.1"),
+				Scores:  []float64{1.5, 2},
+				Filter:  queryFilter{Name: "bob", Tags: []string{"a", "b"}},
+			},
+		},
+		{
+			"bad-int",
+			"limit=ten",
+			http.StatusBadRequest,
+			querySearch{},
+		},
+		{
+			"bad-time",
+			"since=yesterday",
+			http.StatusBadRequest,
+			querySearch{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			got = querySearch{}
+
+			ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NewQueryDecoder(), NoOpEncoder{}, DefaultErrorHandler, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/?"+c.Query, nil)
+
+			ar.ServeHTTP(w, r)
+
+			if w.Code != c.ExpectStatus {
+				t.Fatalf("expected %d got %d: %s", c.ExpectStatus, w.Code, w.Body.String())
+			}
+
+			if !reflect.DeepEqual(got, c.Expect) {
+				t.Errorf("expected %+v got %+v", c.Expect, got)
+			}
+		})
+	}
+}
+
+func TestQueryDecoderUnknownFields(t *testing.T) {
+	qd := &QueryDecoder{DisallowUnknownFields: true}
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodGet, "/search", func(in querySearch) []string {
+		return []string{in.Query}
+	}, WithRouteDecoder(qd))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=x&nope=1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected %d got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=x", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `["x"]` {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
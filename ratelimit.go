@@ -0,0 +1,250 @@
+package autohttp
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+// ErrRateLimited is returned with a 429 when a client has no tokens left
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimit is a token bucket allowing Requests every Per, with up to
+// Burst requests at once
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// refill is the number of tokens added to a bucket each second
+func (rl RateLimit) refill() float64 {
+	return float64(rl.Requests) / rl.Per.Seconds()
+}
+
+// RateLimitResult is the state of a bucket after a request takes a token
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token is available
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// A RateLimitStore holds the buckets of a RateLimiter, so state can be kept
+// outside the process and shared between servers
+type RateLimitStore interface {
+	// Take removes a token from the bucket for key, if one is left
+	Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled, by the rate of the
+	// limiter using it, as limiters with different rates share a store
+	full time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in memory, evicting buckets that
+// have refilled completely
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+// memoryStoreSweepEvery is how many takes pass between evictions
+const memoryStoreSweepEvery = 1024
+
+func (ms *MemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.takes++
+	if ms.takes%memoryStoreSweepEvery == 0 {
+		ms.sweep(now)
+	}
+
+	burst := float64(limit.Burst)
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		ms.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.refill())
+	b.last = now
+
+	res := RateLimitResult{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / limit.refill())
+	}
+
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = secondsToDuration((burst - b.tokens) / limit.refill())
+	b.full = now.Add(res.ResetAfter)
+
+	return res, nil
+}
+
+// sweep evicts buckets that have refilled, which would be recreated full
+func (ms *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range ms.buckets {
+		if !now.Before(b.full) {
+			delete(ms.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// RateLimitKeyFunc picks the bucket a request takes tokens from
+type RateLimitKeyFunc func(r *http.Request) string
+
+// KeyByIP uses the address of the connecting client. Behind a proxy, use
+// KeyByHeader with the header the proxy sets instead
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader uses the value of a request header, such as an API key,
+// falling back to the client IP when it is missing
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		if v := r.Header.Get(name); v != "" {
+			return name + ":" + v
+		}
+		return KeyByIP(r)
+	}
+}
+
+// RateLimiter rejects requests with a 429 once the bucket for their key is
+// empty. Every response carries RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, and rejections carry Retry-After
+type RateLimiter struct {
+	Limit RateLimit
+	Key   RateLimitKeyFunc
+	Store RateLimitStore
+
+	// Name namespaces keys in the Store, so limiters can share one
+	Name string
+
+	now func() time.Time
+}
+
+// NewRateLimiter allows requests every per for each client IP, kept in
+// memory, with a burst of the full amount
+func NewRateLimiter(requests int, per time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Limit: RateLimit{Requests: requests, Per: per, Burst: requests},
+		Key:   KeyByIP,
+		Store: NewMemoryRateLimitStore(),
+		now:   time.Now,
+	}
+}
+
+func (rl *RateLimiter) validate() error {
+	if rl.Limit.Requests <= 0 || rl.Limit.Per <= 0 || rl.Limit.Burst <= 0 {
+		return errors.New("rate limit requests, per and burst must be positive")
+	}
+
+	if rl.Key == nil || rl.Store == nil {
+		return errors.New("rate limiter needs a key func and a store")
+	}
+
+	return nil
+}
+
+// WithRateLimit applies rl to every route on the Router, sharing buckets
+// between routes
+func WithRateLimit(rl *RateLimiter) func(r *Router) error {
+	return func(r *Router) error {
+		err := rl.validate()
+		if err != nil {
+			return err
+		}
+
+		r.rateLimiters = append(r.rateLimiters, rl)
+		return nil
+	}
+}
+
+// WithRouteRateLimit applies rl to a single route, after any router limit
+func WithRouteRateLimit(rl *RateLimiter) RouteOption {
+	return func(rc *routeConfig) error {
+		err := rl.validate()
+		if err != nil {
+			return err
+		}
+
+		rc.rateLimiters = append(rc.rateLimiters, rl)
+		return nil
+	}
+}
+
+type rateLimitHandler struct {
+	limiter      *RateLimiter
+	log          lounge.Log
+	errorHandler ErrorHandler
+	next         http.Handler
+}
+
+func (rh *rateLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rl := rh.limiter
+
+	now := time.Now
+	if rl.now != nil {
+		now = rl.now
+	}
+
+	res, err := rl.Store.Take(rl.Name+"|"+rl.Key(r), rl.Limit, now())
+	if err != nil {
+		// fail open, a broken store should not take the site down
+		rh.log.Errorf("rate limit store failed: %s", err)
+		rh.next.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(rl.Limit.Burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		rh.errorHandler(w, r, ErrorWithCode{Err: ErrRateLimited, StatusCode: http.StatusTooManyRequests})
+		return
+	}
+
+	rh.next.ServeHTTP(w, r)
+}
+
+// ceilSeconds rounds d up to whole seconds, never below 1
+func ceilSeconds(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 1 {
+		return 1
+	}
+	return s
+}
@@ -0,0 +1,176 @@
+package autohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	ms := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 2, Per: time.Second, Burst: 2}
+	start := time.Unix(0, 0)
+
+	cases := []struct {
+		Name            string
+		At              time.Duration
+		ExpectAllowed   bool
+		ExpectRemaining int
+	}{
+		{"first", 0, true, 1},
+		{"second", 0, true, 0},
+		{"empty", 0, false, 0},
+		{"half-refill", 500 * time.Millisecond, true, 0},
+		{"still-empty", 600 * time.Millisecond, false, 0},
+		{"full-again", 5 * time.Second, true, 1},
+	}
+
+	for _, c := range cases {
+		res, err := ms.Take("k", limit, start.Add(c.At))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Allowed != c.ExpectAllowed || res.Remaining != c.ExpectRemaining {
+			t.Errorf("%s: expected allowed=%t remaining=%d got %+v", c.Name, c.ExpectAllowed, c.ExpectRemaining, res)
+		}
+
+		if !res.Allowed && res.RetryAfter <= 0 {
+			t.Errorf("%s: expected a retry after", c.Name)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreShared(t *testing.T) {
+	ms := NewMemoryRateLimitStore()
+	slow := RateLimit{Requests: 1, Per: time.Hour, Burst: 2}
+	fast := RateLimit{Requests: 100, Per: time.Second, Burst: 1}
+	start := time.Unix(0, 0)
+
+	for i := 0; i < 2; i++ {
+		res, err := ms.Take("slow|a", slow, start)
+		if err != nil || !res.Allowed {
+			t.Fatalf("expected the slow bucket to allow take %d: %+v %v", i, res, err)
+		}
+	}
+
+	// enough takes from the fast limiter to sweep the store, long after
+	// its own buckets have refilled but long before the slow one has
+	for i := 0; i < memoryStoreSweepEvery; i++ {
+		_, err := ms.Take("fast|"+strconv.Itoa(i), fast, start.Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := ms.Take("slow|a", slow, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Allowed {
+		t.Error("a sweep by the fast limiter refilled the slow limiter's bucket")
+	}
+
+	// and the fast buckets are still evicted once they have refilled
+	for i := 0; i < memoryStoreSweepEvery; i++ {
+		_, err := ms.Take("fast|x", fast, start.Add(2*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if len(ms.buckets) != 2 || ms.buckets["slow|a"] == nil {
+		t.Errorf("expected refilled fast buckets to be swept, %d left", len(ms.buckets))
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+
+	routerLimit := NewRateLimiter(3, time.Minute)
+	routerLimit.now = clock
+
+	routeLimit := NewRateLimiter(1, time.Minute)
+	routeLimit.Key = KeyByHeader("X-Api-Key")
+	routeLimit.now = clock
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithRateLimit(routerLimit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := func(ctx context.Context) error { return nil }
+	err = r.Register(http.MethodPost, "/open", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/keyed", fn, WithRouteRateLimit(routeLimit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := r.Routes[http.MethodPost]["/keyed"].(*Handler); !ok {
+		t.Error("expected Routes to hold the handler itself")
+	}
+
+	cases := []struct {
+		Name            string
+		Path            string
+		RemoteAddr      string
+		APIKey          string
+		ExpectStatus    int
+		ExpectRemaining string
+	}{
+		{"keyed-a", "/keyed", "10.0.0.1:1", "a", http.StatusOK, "0"},
+		{"keyed-a-again", "/keyed", "10.0.0.1:1", "a", http.StatusTooManyRequests, "0"},
+		{"keyed-b", "/keyed", "10.0.0.1:1", "b", http.StatusOK, "0"},
+		{"router-limit-shared", "/open", "10.0.0.1:1", "", http.StatusTooManyRequests, "0"},
+		{"other-ip", "/open", "10.0.0.2:1", "", http.StatusOK, "2"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, c.Path, nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = c.RemoteAddr
+			if c.APIKey != "" {
+				req.Header.Set("X-Api-Key", c.APIKey)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != c.ExpectStatus {
+				t.Errorf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+
+			if w.Header().Get("RateLimit-Remaining") != c.ExpectRemaining {
+				t.Errorf("expected remaining %s got %q", c.ExpectRemaining, w.Header().Get("RateLimit-Remaining"))
+			}
+
+			if w.Header().Get("RateLimit-Limit") == "" || w.Header().Get("RateLimit-Reset") == "" {
+				t.Error("expected RateLimit headers")
+			}
+
+			if c.ExpectStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("expected Retry-After")
+			}
+		})
+	}
+
+	_, err = NewRouter(nil, WithRateLimit(NewRateLimiter(0, time.Second)))
+	if err == nil {
+		t.Error("expected an invalid limit to be rejected")
+	}
+}
@@ -9,6 +9,7 @@ var (
 	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 	errorType   = reflect.TypeOf((*error)(nil)).Elem()
 	headerType  = reflect.TypeOf(make(Header))
+	paramsType  = reflect.TypeOf(make(PathParams))
 )
 
 func isContextType(t reflect.Type) bool {
@@ -22,3 +23,7 @@ func isErrorType(t reflect.Type) bool {
 func isHeaderType(t reflect.Type) bool {
 	return t == headerType
 }
+
+func isPathParamsType(t reflect.Type) bool {
+	return t == paramsType
+}
@@ -0,0 +1,104 @@
+package autohttp
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// A StatusCoder is a return value that chooses the status code of a
+// successful response, such as 201 Created or 202 Accepted
+type StatusCoder interface {
+	ResponseStatusCode() int
+}
+
+// A ResponseHeaderer is a return value that adds headers to a successful
+// response, such as Location or ETag
+type ResponseHeaderer interface {
+	ResponseHeader() http.Header
+}
+
+// Response is an envelope a function can return to control the status code
+// and headers of its response. Body is passed to the encoder, and when it is
+// nil only the status code and headers are written
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       interface{}
+}
+
+func (resp *Response) ResponseStatusCode() int {
+	return resp.StatusCode
+}
+
+func (resp *Response) ResponseHeader() http.Header {
+	return resp.Header
+}
+
+var responseType = reflect.TypeOf(Response{})
+
+// isResponseType reports whether t is a Response envelope, whose body
+// cannot be checked until the function has been called
+func isResponseType(t reflect.Type) bool {
+	return t == responseType || t == reflect.PtrTo(responseType)
+}
+
+// responseMeta is the status code and headers a function asked for, and
+// the value left to encode once any Response envelope is removed
+type responseMeta struct {
+	statusCode int
+	header     http.Header
+	body       interface{}
+	hasBody    bool
+}
+
+func unwrapResponse(value interface{}) responseMeta {
+	switch v := value.(type) {
+	case Response:
+		return responseMeta{statusCode: v.StatusCode, header: v.Header, body: v.Body, hasBody: v.Body != nil}
+	case *Response:
+		if v == nil {
+			return responseMeta{hasBody: true}
+		}
+
+		return responseMeta{statusCode: v.StatusCode, header: v.Header, body: v.Body, hasBody: v.Body != nil}
+	}
+
+	rm := responseMeta{body: value, hasBody: true}
+	if sc, ok := value.(StatusCoder); ok {
+		rm.statusCode = sc.ResponseStatusCode()
+	}
+
+	if rh, ok := value.(ResponseHeaderer); ok {
+		rm.header = rh.ResponseHeader()
+	}
+
+	return rm
+}
+
+// apply copies the requested headers onto w and returns the status code to
+// write, falling back to the encoder's choice
+func (rm responseMeta) apply(w http.ResponseWriter, encoderStatus int) int {
+	for k, vals := range rm.header {
+		w.Header().Del(k)
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+
+	if rm.statusCode != 0 {
+		return rm.statusCode
+	}
+
+	return encoderStatus
+}
+
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,159 @@
+package autohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+type createdUser struct {
+	ID string `json:"id"`
+}
+
+func (cu createdUser) ResponseStatusCode() int {
+	return http.StatusCreated
+}
+
+func (cu createdUser) ResponseHeader() http.Header {
+	return http.Header{"Location": []string{"/users/" + cu.ID}}
+}
+
+func TestResponseControl(t *testing.T) {
+	cases := []struct {
+		Name         string
+		Encoder      Encoder
+		Fn           interface{}
+		ExpectStatus int
+		ExpectHeader http.Header
+		ExpectBody   string
+	}{
+		{
+			"envelope",
+			&JSONEncoder{},
+			func(ctx context.Context) (*Response, error) {
+				return &Response{
+					StatusCode: http.StatusAccepted,
+					Header:     http.Header{"Etag": []string{`"v1"`}},
+					Body:       map[string]string{"status": "queued"},
+				}, nil
+			},
+			http.StatusAccepted,
+			http.Header{"Etag": []string{`"v1"`}, "Content-Type": []string{"application/json"}},
+			`{"status":"queued"}`,
+		},
+		{
+			"envelope-value",
+			&JSONEncoder{},
+			func(ctx context.Context) Response {
+				return Response{StatusCode: http.StatusCreated, Body: []int{1}}
+			},
+			http.StatusCreated,
+			nil,
+			`[1]`,
+		},
+		{
+			"envelope-without-body",
+			&JSONEncoder{},
+			func(ctx context.Context) *Response {
+				return &Response{Header: http.Header{"Location": []string{"/x"}}}
+			},
+			http.StatusNoContent,
+			http.Header{"Location": []string{"/x"}},
+			``,
+		},
+		{
+			"interfaces",
+			&JSONEncoder{},
+			func(ctx context.Context) (createdUser, error) {
+				return createdUser{ID: "42"}, nil
+			},
+			http.StatusCreated,
+			http.Header{"Location": []string{"/users/42"}},
+			`{"id":"42"}`,
+		},
+		{
+			"noop-encoder",
+			NoOpEncoder{},
+			func(ctx context.Context) *Response {
+				return &Response{StatusCode: http.StatusAccepted}
+			},
+			http.StatusAccepted,
+			nil,
+			``,
+		},
+		{
+			"default-status",
+			&JSONEncoder{},
+			func(ctx context.Context) map[string]string {
+				return map[string]string{}
+			},
+			http.StatusOK,
+			nil,
+			`{}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NewJSONDecoder(), c.Encoder, DefaultErrorHandler, c.Fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+			r.Header.Set("Content-Type", "application/json")
+
+			ar.ServeHTTP(w, r)
+
+			if w.Code != c.ExpectStatus {
+				t.Errorf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+
+			for k := range c.ExpectHeader {
+				if w.Header().Get(k) != c.ExpectHeader.Get(k) {
+					t.Errorf("expected header %s=%q got %q", k, c.ExpectHeader.Get(k), w.Header().Get(k))
+				}
+			}
+
+			if strings.TrimSpace(w.Body.String()) != c.ExpectBody {
+				t.Errorf("expected body %q got %q", c.ExpectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestResponseValidation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name      string
+		Encoder   Encoder
+		Fn        interface{}
+		ShouldErr bool
+	}{
+		{"json-chan", &JSONEncoder{}, func() chan int { return nil }, true},
+		{"json-envelope", &JSONEncoder{}, func() *Response { return nil }, false},
+		{"csv-envelope", &CSVEncoder{}, func() (*Response, error) { return nil, nil }, false},
+		{"noop-envelope", NoOpEncoder{}, func() Response { return Response{} }, false},
+		{"noop-value", NoOpEncoder{}, func() createdUser { return createdUser{} }, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			err := c.Encoder.ValidateType(c.Fn)
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package autohttp
+
+// A RouteGroup registers routes under a shared path prefix and
+// runs its middleware for every route in the group
+type RouteGroup struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// Group creates a RouteGroup rooted at prefix
+func (r *Router) Group(prefix string, mw ...Middleware) *RouteGroup {
+	return &RouteGroup{
+		router:     r,
+		prefix:     prefix,
+		middleware: mw,
+	}
+}
+
+// Group creates a nested RouteGroup, whose middleware runs after the
+// middleware of its parent
+func (rg *RouteGroup) Group(prefix string, mw ...Middleware) *RouteGroup {
+	var middleware []Middleware
+	middleware = append(middleware, rg.middleware...)
+	middleware = append(middleware, mw...)
+
+	return &RouteGroup{
+		router:     rg.router,
+		prefix:     rg.prefix + prefix,
+		middleware: middleware,
+	}
+}
+
+func (rg *RouteGroup) Register(method string, path string, fn interface{}, opts ...RouteOption) error {
+	return rg.router.register(method, rg.prefix+path, fn, rg.middleware, opts)
+}
+
+func (rg *RouteGroup) RegisterJob(path string, fn interface{}, opts ...RouteOption) error {
+	return rg.router.registerJob(rg.prefix+path, fn, rg.middleware, opts)
+}
@@ -0,0 +1,324 @@
+package autohttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PathParams holds the values captured from a route pattern such as
+// /users/{id}. It can be accepted as an argument by any handler function
+type PathParams map[string]string
+
+type pathParamsKey struct{}
+
+// GetPathParams returns the path params captured for r by the Router, for use
+// in plain http.Handlers
+func GetPathParams(r *http.Request) PathParams {
+	pp, _ := r.Context().Value(pathParamsKey{}).(PathParams)
+	if pp == nil {
+		return PathParams{}
+	}
+
+	return pp
+}
+
+func withPathParams(r *http.Request, pp PathParams) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, pp))
+}
+
+// routingPath is the path matched against routes. It is u.Path, unless a
+// segment holds an escaped /, in which case each segment is unescaped on
+// its own, leaving / and % escaped so the segment stays whole. escaped
+// reports whether captured params then need unescaping
+func routingPath(u *url.URL) (path string, escaped bool) {
+	if u.RawPath == "" || !strings.Contains(strings.ToUpper(u.RawPath), "%2F") {
+		return u.Path, false
+	}
+
+	segments := strings.Split(u.RawPath, "/")
+	for i, seg := range segments {
+		unescaped, err := url.PathUnescape(seg)
+		if err != nil {
+			return u.Path, false
+		}
+		segments[i] = segmentEscaper.Replace(unescaped)
+	}
+
+	return strings.Join(segments, "/"), true
+}
+
+var segmentEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// unescapeParams undoes the escaping of routingPath in captured params
+func unescapeParams(pp PathParams) {
+	for k, v := range pp {
+		if unescaped, err := url.PathUnescape(v); err == nil {
+			pp[k] = unescaped
+		}
+	}
+}
+
+// routeNode is a node in the radix tree used to match request paths.
+// Static prefixes are compressed into single edges, and a {param}
+// segment hangs off its parent as a separate child.
+//
+// When matching, static children are always tried before the param child,
+// and the param child before the catch-all, so /users/new takes precedence
+// over /users/{id}, and /static/admin/* over /static/*
+type routeNode struct {
+	prefix   string
+	children []*routeNode
+
+	param     *routeNode
+	catchAll  *routeNode
+	paramName string
+
+	// set on nodes that terminate a pattern
+	pattern    string
+	paramNames []string
+	handlers   map[string]http.Handler
+}
+
+type patternToken struct {
+	static   string
+	param    string
+	catchAll bool
+}
+
+// anonymousCatchAll is the PathParams key for a pattern ending in *
+const anonymousCatchAll = "*"
+
+func parsePattern(pattern string) ([]patternToken, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("route pattern %q must begin with /", pattern)
+	}
+
+	var tokens []patternToken
+	seen := make(map[string]bool)
+	rest := pattern
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		star := strings.IndexByte(rest, '*')
+		if star != -1 && (open == -1 || star < open) {
+			if star != len(rest)-1 || rest[star-1] != '/' {
+				return nil, fmt.Errorf("route pattern %q: * must be the entire final path segment", pattern)
+			}
+
+			tokens = append(tokens, patternToken{static: rest[:star]}, patternToken{param: anonymousCatchAll, catchAll: true})
+			break
+		}
+
+		if open == -1 {
+			if strings.IndexByte(rest, '}') != -1 {
+				return nil, fmt.Errorf("route pattern %q has an unmatched }", pattern)
+			}
+
+			tokens = append(tokens, patternToken{static: rest})
+			break
+		}
+
+		if open == 0 || rest[open-1] != '/' {
+			return nil, fmt.Errorf("route pattern %q: params must span a full path segment", pattern)
+		}
+
+		if strings.IndexByte(rest[:open], '}') != -1 {
+			return nil, fmt.Errorf("route pattern %q has an unmatched }", pattern)
+		}
+
+		tokens = append(tokens, patternToken{static: rest[:open]})
+
+		close := strings.IndexByte(rest, '}')
+		if close == -1 {
+			return nil, fmt.Errorf("route pattern %q has an unmatched {", pattern)
+		}
+
+		name := rest[open+1 : close]
+		catchAll := strings.HasSuffix(name, "...")
+		if catchAll {
+			name = strings.TrimSuffix(name, "...")
+			if close != len(rest)-1 {
+				return nil, fmt.Errorf("route pattern %q: {%s...} must be the final path segment", pattern, name)
+			}
+		}
+
+		if name == "" || strings.ContainsAny(name, "{/.") {
+			return nil, fmt.Errorf("route pattern %q has an invalid param name %q", pattern, name)
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("route pattern %q uses param %q more than once", pattern, name)
+		}
+		seen[name] = true
+
+		rest = rest[close+1:]
+		if rest != "" && rest[0] != '/' {
+			return nil, fmt.Errorf("route pattern %q: params must span a full path segment", pattern)
+		}
+
+		tokens = append(tokens, patternToken{param: name, catchAll: catchAll})
+	}
+
+	return tokens, nil
+}
+
+// insert adds a handler for method at pattern, returning an error if it
+// would conflict with an existing route
+func (n *routeNode) insert(method string, pattern string, h http.Handler) error {
+	tokens, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	var paramNames []string
+	cur := n
+	for _, tok := range tokens {
+		if tok.param == "" {
+			cur = cur.insertStatic(tok.static)
+			continue
+		}
+
+		paramNames = append(paramNames, tok.param)
+
+		if tok.catchAll {
+			if cur.catchAll == nil {
+				cur.catchAll = &routeNode{paramName: tok.param}
+			} else if cur.catchAll.paramName != tok.param {
+				return fmt.Errorf("wildcard route %q overlaps ambiguously with %q", pattern, cur.catchAll.pattern)
+			}
+
+			cur = cur.catchAll
+			continue
+		}
+
+		if cur.param == nil {
+			cur.param = &routeNode{paramName: tok.param}
+		} else if cur.param.paramName != tok.param {
+			return fmt.Errorf("route pattern %q conflicts with existing param {%s}", pattern, cur.param.paramName)
+		}
+
+		cur = cur.param
+	}
+
+	if cur.handlers == nil {
+		cur.handlers = make(map[string]http.Handler)
+	}
+
+	if _, ok := cur.handlers[method]; ok {
+		return fmt.Errorf("route already registered: %s %s", method, pattern)
+	}
+
+	cur.pattern = pattern
+	cur.paramNames = paramNames
+	cur.handlers[method] = h
+
+	return nil
+}
+
+func (n *routeNode) insertStatic(text string) *routeNode {
+	if text == "" {
+		return n
+	}
+
+	for _, c := range n.children {
+		if c.prefix[0] != text[0] {
+			continue
+		}
+
+		l := commonPrefixLen(c.prefix, text)
+		if l < len(c.prefix) {
+			split := *c
+			split.prefix = c.prefix[l:]
+			*c = routeNode{prefix: c.prefix[:l], children: []*routeNode{&split}}
+		}
+
+		return c.insertStatic(text[l:])
+	}
+
+	child := &routeNode{prefix: text}
+	n.children = append(n.children, child)
+	return child
+}
+
+// lookupMethod finds the most specific node with a handler for method
+// matching path, along with the params captured on the way there. Nodes
+// without one are skipped, so /users/{id} still answers GET /users/new
+// when /users/new is only registered for POST
+func (n *routeNode) lookupMethod(path string, method string) (*routeNode, PathParams) {
+	return n.find(path, func(c *routeNode) bool {
+		_, ok := c.handlers[method]
+		return ok
+	})
+}
+
+func (n *routeNode) find(path string, accept func(*routeNode) bool) (*routeNode, PathParams) {
+	found, values := n.match(path, nil, accept)
+	if found == nil {
+		return nil, nil
+	}
+
+	if len(values) == 0 {
+		return found, nil
+	}
+
+	pp := make(PathParams, len(values))
+	for i, v := range values {
+		pp[found.paramNames[i]] = v
+	}
+
+	return found, pp
+}
+
+func (n *routeNode) match(path string, values []string, accept func(*routeNode) bool) (*routeNode, []string) {
+	if path == "" {
+		if accept(n) {
+			return n, values
+		}
+
+		if n.catchAll != nil && accept(n.catchAll) {
+			return n.catchAll, append(values, "")
+		}
+
+		return nil, nil
+	}
+
+	for _, c := range n.children {
+		if strings.HasPrefix(path, c.prefix) {
+			found, vals := c.match(path[len(c.prefix):], values, accept)
+			if found != nil {
+				return found, vals
+			}
+		}
+	}
+
+	if n.param != nil {
+		end := strings.IndexByte(path, '/')
+		if end == -1 {
+			end = len(path)
+		}
+
+		if end > 0 {
+			found, vals := n.param.match(path[end:], append(values, path[:end]), accept)
+			if found != nil {
+				return found, vals
+			}
+		}
+	}
+
+	if n.catchAll != nil && accept(n.catchAll) {
+		return n.catchAll, append(values, path)
+	}
+
+	return nil, nil
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return i
+}
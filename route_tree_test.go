@@ -0,0 +1,250 @@
+package autohttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestRouteTreeLookup(t *testing.T) {
+	t.Parallel()
+
+	patterns := []string{
+		"/",
+		"/users",
+		"/users/new",
+		"/users/{id}",
+		"/users/{id}/posts",
+		"/users/{id}/posts/{postID}",
+		"/usage",
+		"/{org}/settings",
+	}
+
+	tree := &routeNode{}
+	for _, p := range patterns {
+		err := tree.insert(http.MethodGet, p, http.NotFoundHandler())
+		if err != nil {
+			t.Fatalf("inserting %s: %s", p, err)
+		}
+	}
+
+	// only registered for POST, so GET falls through to /users/{id}
+	err := tree.insert(http.MethodPost, "/users/mine", http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Path          string
+		ExpectPattern string
+		ExpectParams  PathParams
+	}{
+		{"/", "/", nil},
+		{"/users/mine", "/users/{id}", PathParams{"id": "mine"}},
+		{"/users", "/users", nil},
+		{"/users/new", "/users/new", nil},
+		{"/users/newer", "/users/{id}", PathParams{"id": "newer"}},
+		{"/users/42", "/users/{id}", PathParams{"id": "42"}},
+		{"/users/42/posts", "/users/{id}/posts", nil},
+		{"/users/42/posts/7", "/users/{id}/posts/{postID}", PathParams{"id": "42", "postID": "7"}},
+		{"/usage", "/usage", nil},
+		{"/acme/settings", "/{org}/settings", PathParams{"org": "acme"}},
+		{"/users/", "", nil},
+		{"/users/42/posts/7/extra", "", nil},
+		{"/nope", "", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Path, func(t *testing.T) {
+			node, pp := tree.lookupMethod(c.Path, http.MethodGet)
+			if c.ExpectPattern == "" {
+				if node != nil {
+					t.Fatalf("expected no match, got %s", node.pattern)
+				}
+				return
+			}
+
+			if node == nil {
+				t.Fatalf("expected %s, got no match", c.ExpectPattern)
+			}
+
+			if node.pattern != c.ExpectPattern {
+				t.Errorf("expected %s got %s", c.ExpectPattern, node.pattern)
+			}
+
+			if c.ExpectParams != nil && !reflect.DeepEqual(pp, c.ExpectParams) {
+				t.Errorf("expected params %v got %v", c.ExpectParams, pp)
+			}
+		})
+	}
+}
+
+func TestRouteTreeConflicts(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name     string
+		Patterns []string
+	}{
+		{"duplicate", []string{"/a/b", "/a/b"}},
+		{"param-names", []string{"/users/{id}", "/users/{userID}/posts"}},
+		{"partial-segment", []string{"/users/x{id}"}},
+		{"unclosed", []string{"/users/{id"}},
+		{"repeated-param", []string{"/{id}/{id}"}},
+		{"no-slash", []string{"users"}},
+		{"ambiguous-wildcards", []string{"/static/*", "/static/{rest...}"}},
+		{"wildcard-names", []string{"/files/{rest...}", "/files/{path...}"}},
+		{"star-mid-pattern", []string{"/static/*/foo"}},
+		{"star-partial-segment", []string{"/static*"}},
+		{"catch-all-mid-pattern", []string{"/files/{rest...}/foo"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			tree := &routeNode{}
+
+			var err error
+			for _, p := range c.Patterns {
+				err = tree.insert(http.MethodGet, p, http.NotFoundHandler())
+				if err != nil {
+					break
+				}
+			}
+
+			if err == nil {
+				t.Errorf("expected an error registering %v", c.Patterns)
+			}
+		})
+	}
+}
+
+func TestRouteTreeWildcards(t *testing.T) {
+	t.Parallel()
+
+	patterns := []string{
+		"/static/*",
+		"/static/admin/*",
+		"/static/admin/login",
+		"/files/{rest...}",
+		"/users/{id}/files/{rest...}",
+	}
+
+	tree := &routeNode{}
+	for _, p := range patterns {
+		err := tree.insert(http.MethodGet, p, http.NotFoundHandler())
+		if err != nil {
+			t.Fatalf("inserting %s: %s", p, err)
+		}
+	}
+
+	cases := []struct {
+		Path          string
+		ExpectPattern string
+		ExpectParams  PathParams
+	}{
+		{"/static/app.js", "/static/*", PathParams{"*": "app.js"}},
+		{"/static/", "/static/*", PathParams{"*": ""}},
+		{"/static/adminx", "/static/*", PathParams{"*": "adminx"}},
+		{"/static/admin/panel.js", "/static/admin/*", PathParams{"*": "panel.js"}},
+		{"/static/admin/login", "/static/admin/login", nil},
+		{"/files/a/b/c.txt", "/files/{rest...}", PathParams{"rest": "a/b/c.txt"}},
+		{"/users/4/files/a/b", "/users/{id}/files/{rest...}", PathParams{"id": "4", "rest": "a/b"}},
+		{"/static", "", nil},
+	}
+
+	// repeat lookups, the result must never depend on iteration order
+	for i := 0; i < 10; i++ {
+		for _, c := range cases {
+			node, pp := tree.lookupMethod(c.Path, http.MethodGet)
+			if c.ExpectPattern == "" {
+				if node != nil {
+					t.Fatalf("%s: expected no match, got %s", c.Path, node.pattern)
+				}
+				continue
+			}
+
+			if node == nil || node.pattern != c.ExpectPattern {
+				t.Fatalf("%s: expected %s got %v", c.Path, c.ExpectPattern, node)
+			}
+
+			if c.ExpectParams != nil && !reflect.DeepEqual(pp, c.ExpectParams) {
+				t.Errorf("%s: expected params %v got %v", c.Path, c.ExpectParams, pp)
+			}
+		}
+	}
+}
+
+func TestRouterPathParams(t *testing.T) {
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/users/{id}/posts/{postID}", func(ctx context.Context, pp PathParams, in struct{ Title string }) map[string]string {
+		return map[string]string{"user": pp["id"], "post": pp["postID"], "title": in.Title}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/users/42/posts/7", strings.NewReader(`{"Title": "hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %d got %d", http.StatusOK, w.Code)
+	}
+
+	expected := `{"post":"7","title":"hi","user":"42"}`
+	if strings.TrimSpace(w.Body.String()) != expected {
+		t.Errorf("expected %s got %s", expected, w.Body.String())
+	}
+}
+
+func TestRouterEscapedPathParams(t *testing.T) {
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pattern := range []string{"/users/{id}", "/users/{id}/posts", "/files/{rest...}"} {
+		pattern := pattern
+		err = r.Register(http.MethodGet, pattern, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			pp := GetPathParams(req)
+			w.Write([]byte(pattern + " " + pp["id"] + pp["rest"]))
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		Path   string
+		Expect string
+	}{
+		{"/users/a%2Fb", "/users/{id} a/b"},
+		{"/users/a%2fb/posts", "/users/{id}/posts a/b"},
+		{"/users/a%20b%2Fc", "/users/{id} a b/c"},
+		{"/users/a%252Fb", "/users/{id} a%2Fb"},
+		{"/users/100%25%2F", "/users/{id} 100%/"},
+		{"/files/a%2Fb/c", "/files/{rest...} a/b/c"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.Path, nil))
+
+			if w.Code != http.StatusOK || w.Body.String() != c.Expect {
+				t.Errorf("expected %q got %d %q", c.Expect, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -8,48 +8,65 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/fortytw2/autohttp/internal/httpsnoop"
 	"github.com/fortytw2/lounge"
 )
 
-type embeddedAssets struct {
-	staticDir fs.FS
-}
-
-func newEmbeddedAssets(assets fs.FS, distDir string) (*embeddedAssets, error) {
-	staticFS, err := fs.Sub(assets, distDir)
-	if err != nil {
-		return nil, err
-	}
-
-	return &embeddedAssets{
-		staticDir: staticFS,
-	}, nil
-}
-
 type Router struct {
-	Routes     map[string]map[string]http.Handler
-	starRoutes map[string]http.Handler
+	// Routes holds every registered handler, keyed by method and then route pattern
+	Routes map[string]map[string]http.Handler
+	tree   *routeNode
+	// methods can be registered, see WithMethods
+	methods map[string]bool
 
 	embeddedAssets *embeddedAssets
+	devAssets      http.Handler
 
 	log lounge.Log
 
+	middleware []Middleware
+
 	enableHSTS         bool
 	enableRouteMetrics bool
 
 	defaultEncoder      Encoder
 	defaultDecoder      Decoder
 	defaultErrorHandler ErrorHandler
+	errorMap            *ErrorMap
+	panicHook           PanicHook
+
+	csp             *ContentSecurityPolicy
+	securityHeaders *SecurityHeaders
+
+	rateLimiters []*RateLimiter
+
+	cors *CORSPolicy
+	// routeCORS holds the resolved CORSPolicy of each route, keyed like
+	// Routes, to answer preflights
+	routeCORS map[string]map[string]*CORSPolicy
+
+	jobRunner *JobRunner
+
+	metricsCollectors []MetricsCollector
+	tracer            *tracer
+
+	// closers release resources held by options, see Close
+	closers []func() error
+
+	// optionRoutes are registered by options once every option has been
+	// applied, so router wide settings given later still cover them
+	optionRoutes []func() error
 }
 
 type RouterOption func(r *Router) error
 
+// EnableHSTS sends DefaultHSTS over TLS, unless WithSecurityHeaders
+// configures a policy of its own
 func EnableHSTS(r *Router) error {
 	r.enableHSTS = true
 	return nil
 }
 
+// EnableRouteMetrics logs the metrics of every request at debug level
 func EnableRouteMetrics(r *Router) error {
 	r.enableRouteMetrics = true
 	return nil
@@ -88,25 +105,86 @@ func WithDefaultErrorHandler(eh ErrorHandler) func(r *Router) error {
 	}
 }
 
+// WithErrorMap translates errors returned by any route into status codes
+// before they reach the ErrorHandler
+func WithErrorMap(em *ErrorMap) func(r *Router) error {
+	return func(r *Router) error {
+		r.errorMap = em
+		return nil
+	}
+}
+
+// WithPanicHook is called with every panic recovered from a route
+func WithPanicHook(hook PanicHook) func(r *Router) error {
+	return func(r *Router) error {
+		r.panicHook = hook
+		return nil
+	}
+}
+
+// WithMiddleware adds middleware that runs before every route on the Router,
+// ahead of any group or route middleware
+func WithMiddleware(mw ...Middleware) func(r *Router) error {
+	return func(r *Router) error {
+		r.middleware = append(r.middleware, mw...)
+		return nil
+	}
+}
+
 var DefaultOptions = []RouterOption{
 	WithDefaultDecoder(NewJSONDecoder()),
 	WithDefaultEncoder(&JSONEncoder{}),
 }
 
 func NewRouter(log lounge.Log, routerOptions ...RouterOption) (*Router, error) {
-	r := &Router{log: log, Routes: make(map[string]map[string]http.Handler), starRoutes: make(map[string]http.Handler)}
+	if log == nil {
+		log = lounge.NewDefaultLog()
+	}
+
+	r := &Router{
+		log:       log,
+		Routes:    make(map[string]map[string]http.Handler),
+		routeCORS: make(map[string]map[string]*CORSPolicy),
+		methods:   make(map[string]bool, len(defaultMethods)),
+		tree:      &routeNode{},
+	}
+	for m := range defaultMethods {
+		r.methods[m] = true
+	}
+
 	for _, ro := range append(DefaultOptions, routerOptions...) {
 		err := ro(r)
 		if err != nil {
+			// stop anything started by earlier options, as the caller
+			// gets no Router to close
+			r.Close()
 			return nil, err
 		}
 	}
 
+	for _, register := range r.optionRoutes {
+		err := register()
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	r.optionRoutes = nil
+
 	return r, nil
 
 }
 
-var validMethods = map[string]bool{
+// registerAfterOptions queues a route registered by a RouterOption until
+// NewRouter has applied every option
+func (r *Router) registerAfterOptions(method, path string, h http.Handler) {
+	r.optionRoutes = append(r.optionRoutes, func() error {
+		return r.Register(method, path, h)
+	})
+}
+
+// defaultMethods can be registered on every Router, see WithMethods
+var defaultMethods = map[string]bool{
 	http.MethodGet:    true,
 	http.MethodDelete: true,
 	http.MethodPatch:  true,
@@ -114,48 +192,233 @@ var validMethods = map[string]bool{
 	http.MethodPut:    true,
 }
 
-func (r *Router) Register(method string, path string, fn interface{}) error {
-	if strings.Contains(path, "*") {
-		if httpHandler, ok := fn.(http.Handler); ok {
-			r.starRoutes[path] = httpHandler
-			return nil
+// routeConfig holds the per-route settings given to Register
+type routeConfig struct {
+	middleware   []Middleware
+	decoder      Decoder
+	encoder      Encoder
+	errorHandler ErrorHandler
+	name         string
+	hidden       bool
+
+	rateLimiters []*RateLimiter
+	throttler    *Throttler
+	cors         *CORSPolicy
+}
+
+type RouteOption func(rc *routeConfig) error
+
+// WithRouteMiddleware adds middleware that runs only for a single route,
+// after any router and group middleware
+func WithRouteMiddleware(mw ...Middleware) RouteOption {
+	return func(rc *routeConfig) error {
+		rc.middleware = append(rc.middleware, mw...)
+		return nil
+	}
+}
+
+// WithRouteDecoder overrides the Router's default decoder for a single route,
+// such as using a QueryDecoder for a GET endpoint
+func WithRouteDecoder(d Decoder) RouteOption {
+	return func(rc *routeConfig) error {
+		rc.decoder = d
+		return nil
+	}
+}
+
+// WithRouteEncoder overrides the Router's default encoder for a single route,
+// such as a NegotiatingEncoder for endpoints that serve several formats
+func WithRouteEncoder(e Encoder) RouteOption {
+	return func(rc *routeConfig) error {
+		rc.encoder = e
+		return nil
+	}
+}
+
+// WithRouteErrorHandler overrides the Router's default ErrorHandler for a single route
+func WithRouteErrorHandler(eh ErrorHandler) RouteOption {
+	return func(rc *routeConfig) error {
+		rc.errorHandler = eh
+		return nil
+	}
+}
+
+// WithRouteName names the route for introspectors, such as the operationId
+// in OpenAPI. Unnamed routes are named after their function
+func WithRouteName(name string) RouteOption {
+	return func(rc *routeConfig) error {
+		rc.name = name
+		return nil
+	}
+}
+
+// HideFromIntrospectors leaves the route out of generated documents and clients
+func HideFromIntrospectors(rc *routeConfig) error {
+	rc.hidden = true
+	return nil
+}
+
+// resolveRouteConfig applies opts, filling in the Router's defaults for
+// anything they leave unset
+func (r *Router) resolveRouteConfig(opts []RouteOption) (*routeConfig, error) {
+	rc := &routeConfig{}
+	for _, o := range opts {
+		err := o(rc)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if ok := validMethods[method]; !ok {
-		return fmt.Errorf("invalid http method: %s", method)
+	if rc.decoder == nil {
+		rc.decoder = r.defaultDecoder
 	}
 
-	_, ok := r.Routes[method]
-	if !ok {
-		r.Routes[method] = make(map[string]http.Handler)
+	if rc.encoder == nil {
+		rc.encoder = r.defaultEncoder
+	}
+
+	if rc.errorHandler == nil {
+		rc.errorHandler = r.defaultErrorHandler
 	}
 
-	_, ok = r.Routes[method][path]
+	if rc.errorHandler == nil {
+		rc.errorHandler = DefaultErrorHandler
+	}
+
+	if rc.cors == nil {
+		rc.cors = r.cors
+	}
+
+	return rc, nil
+}
+
+// Register adds fn as the handler for method at path. path may contain
+// params spanning a full segment, such as /users/{id}/posts/{postID},
+// which are passed to fn as PathParams. An escaped / in a param, as in
+// /users/a%2Fb, stays within the segment and is passed to fn unescaped.
+//
+// A path ending in * or a named catch-all such as /files/{rest...} matches
+// every path below it, with the remainder stored under "*" or the given
+// name. When several wildcard routes match, the longest prefix wins, and
+// two wildcards at the same prefix are rejected as ambiguous.
+//
+// HEAD and OPTIONS are answered automatically from the registered routes,
+// other methods beyond GET, POST, PUT, PATCH and DELETE need WithMethods
+func (r *Router) Register(method string, path string, fn interface{}, opts ...RouteOption) error {
+	return r.register(method, path, fn, nil, opts)
+}
+
+func (r *Router) register(method string, path string, fn interface{}, groupMiddleware []Middleware, opts []RouteOption) error {
+	rc, err := r.resolveRouteConfig(opts)
+	if err != nil {
+		return err
+	}
+
+	// middleware always runs router -> group -> route
+	var middleware []Middleware
+	middleware = append(middleware, r.middleware...)
+	middleware = append(middleware, groupMiddleware...)
+	middleware = append(middleware, rc.middleware...)
+
+	if ok := r.methods[method]; !ok {
+		return fmt.Errorf("invalid http method: %s", method)
+	}
+
+	_, ok := r.Routes[method][path]
 	if ok {
 		return errors.New("route already registered")
 	}
 
+	decoder, encoder, errorHandler := rc.decoder, rc.encoder, rc.errorHandler
+
+	em := r.errorMap
+	mappedErrorHandler := func(w http.ResponseWriter, req *http.Request, err error) {
+		errorHandler(w, req, em.apply(err))
+	}
+
+	var handler http.Handler
 	if httpHandler, ok := fn.(http.Handler); ok {
-		r.Routes[method][path] = httpHandler
-		return nil
+		handler = &recoveryHandler{
+			next:         wrapMiddleware(httpHandler, middleware, mappedErrorHandler),
+			log:          r.log,
+			hook:         r.panicHook,
+			errorHandler: mappedErrorHandler,
+		}
+	} else {
+		h, err := NewHandler(r.log, decoder, encoder, errorHandler, fn)
+		if err != nil {
+			return err
+		}
+		h.middleware = middleware
+		h.errorMap = r.errorMap
+		h.panicHook = r.panicHook
+		h.name = rc.name
+		h.hideFromIntrospectors = rc.hidden
+
+		handler = h
+	}
+
+	// Routes keeps the handler itself for introspection, while the tree
+	// dispatches through any limits in front of it
+	dispatch := handler
+	if rc.throttler != nil {
+		dispatch = &throttleHandler{throttler: rc.throttler, errorHandler: mappedErrorHandler, next: dispatch}
+	}
+
+	limiters := append(append([]*RateLimiter{}, r.rateLimiters...), rc.rateLimiters...)
+	for i := len(limiters) - 1; i >= 0; i-- {
+		dispatch = &rateLimitHandler{limiter: limiters[i], log: r.log, errorHandler: mappedErrorHandler, next: dispatch}
 	}
 
-	h, err := NewHandler(r.log, r.defaultDecoder, r.defaultEncoder, r.defaultErrorHandler, fn)
+	// CORS headers go outermost so browsers can read rate limit errors too
+	if rc.cors != nil {
+		dispatch = &corsHandler{policy: rc.cors, next: dispatch}
+	}
+
+	err = r.tree.insert(method, path, dispatch)
 	if err != nil {
 		return err
 	}
 
-	r.Routes[method][path] = h
+	_, ok = r.Routes[method]
+	if !ok {
+		r.Routes[method] = make(map[string]http.Handler)
+	}
+
+	r.Routes[method][path] = handler
+
+	if rc.cors != nil {
+		if r.routeCORS[method] == nil {
+			r.routeCORS[method] = make(map[string]*CORSPolicy)
+		}
+
+		r.routeCORS[method][path] = rc.cors
+	}
 
 	return nil
 }
 
+// Close releases resources started by RouterOptions, such as the command
+// run by WithDevBuild
+func (r *Router) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		err := c()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	r.closers = nil
+	return firstErr
+}
+
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if r.enableRouteMetrics {
-		m := httpsnoop.CaptureMetrics(http.HandlerFunc(r.internalServeHTTP), w, req)
-		r.log.Debugf("served %d bytes for %s %s in %s with code %d", m.Written, req.Method, req.URL.Path, m.Duration, m.Code)
+	r.applySecurityHeaders(w, req)
+	req = r.applyCSP(w, req)
 
+	if r.enableRouteMetrics || len(r.metricsCollectors) > 0 || r.tracer != nil {
+		r.serveInstrumented(w, req)
 		return
 	}
 
@@ -163,39 +426,36 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 func (r *Router) internalServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if req.Method == http.MethodOptions {
-		return
-	}
-
-	for path, handler := range r.starRoutes {
-		pathPrefix := strings.ReplaceAll(path, "*", "")
-		if strings.HasPrefix(req.URL.Path, pathPrefix) {
-			handler.ServeHTTP(w, req)
-			return
-		}
-	}
-
 	method := strings.ToUpper(req.Method)
-	routes, ok := r.Routes[method]
-	if !ok {
-		if method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
+	node, method, pathParams := r.findRoute(req.URL, method)
+	if node == nil {
+		methods := r.allowedMethods(req.URL)
+		switch {
+		case len(methods) == 0 && method == http.MethodOptions:
+			w.WriteHeader(http.StatusNotFound)
+		case len(methods) == 0:
+			r.serveNotFound(w, req)
+		case method == http.MethodOptions:
+			r.serveOptions(w, req, methods)
+		default:
+			r.serveMethodNotAllowed(w, methods)
 		}
 
-		r.serveNotFound(w, req)
 		r.cleanLeftovers(req)
 		return
 	}
 
-	route, ok := routes[req.URL.Path]
-	if !ok {
-		r.serveNotFound(w, req)
-		r.cleanLeftovers(req)
-		return
+	if pathParams != nil {
+		req = withPathParams(req, pathParams)
+	}
+
+	setRoutePattern(req, node.pattern)
+
+	if method != strings.ToUpper(req.Method) {
+		w = discardBody(w)
 	}
 
-	route.ServeHTTP(w, req)
+	node.handlers[method].ServeHTTP(w, req)
 	r.cleanLeftovers(req)
 }
 
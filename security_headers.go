@@ -0,0 +1,173 @@
+package autohttp
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HSTS is a Strict-Transport-Security policy
+type HSTS struct {
+	MaxAge            time.Duration
+	IncludeSubDomains bool
+	// Preload opts into browser preload lists, which requires a MaxAge of
+	// at least a year and IncludeSubDomains
+	Preload bool
+}
+
+// DefaultHSTS is the policy sent by EnableHSTS
+var DefaultHSTS = HSTS{MaxAge: 2 * 365 * 24 * time.Hour, IncludeSubDomains: true}
+
+func (h HSTS) String() string {
+	v := "max-age=" + strconv.FormatInt(int64(h.MaxAge/time.Second), 10)
+	if h.IncludeSubDomains {
+		v += "; includeSubDomains"
+	}
+	if h.Preload {
+		v += "; preload"
+	}
+	return v
+}
+
+// SecurityHeaders is a set of response headers sent with every response
+// from the Router, including raw handlers, embedded assets and 404s. Empty
+// fields are not sent, and handlers may override any of them
+type SecurityHeaders struct {
+	// HSTS is only sent over TLS, or when TrustForwardedProto is set and
+	// a proxy reports the request arrived over https
+	HSTS                *HSTS
+	TrustForwardedProto bool
+
+	// ContentTypeOptions is sent as X-Content-Type-Options, usually nosniff
+	ContentTypeOptions string
+	// FrameOptions is sent as X-Frame-Options, DENY or SAMEORIGIN
+	FrameOptions   string
+	ReferrerPolicy string
+	// PermissionsPolicy maps features to the origins allowed to use them.
+	// "self" and "*" are written as keywords, an empty list disables the
+	// feature entirely
+	PermissionsPolicy map[string][]string
+
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+}
+
+// DefaultSecurityHeaders returns a strict policy suitable for most apps
+func DefaultSecurityHeaders() *SecurityHeaders {
+	hsts := DefaultHSTS
+	return &SecurityHeaders{
+		HSTS:                      &hsts,
+		ContentTypeOptions:        "nosniff",
+		FrameOptions:              "DENY",
+		ReferrerPolicy:            "strict-origin-when-cross-origin",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginResourcePolicy: "same-origin",
+		PermissionsPolicy: map[string][]string{
+			"camera":      {},
+			"geolocation": {},
+			"microphone":  {},
+		},
+	}
+}
+
+// WithSecurityHeaders sends sh with every response from the Router
+func WithSecurityHeaders(sh *SecurityHeaders) func(r *Router) error {
+	return func(r *Router) error {
+		r.securityHeaders = sh
+		return nil
+	}
+}
+
+func (sh *SecurityHeaders) permissionsPolicy() string {
+	features := make([]string, 0, len(sh.PermissionsPolicy))
+	for f := range sh.PermissionsPolicy {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+
+	parts := make([]string, 0, len(features))
+	for _, f := range features {
+		origins := make([]string, 0, len(sh.PermissionsPolicy[f]))
+		for _, o := range sh.PermissionsPolicy[f] {
+			if o == "self" || o == "*" {
+				origins = append(origins, o)
+			} else {
+				origins = append(origins, strconv.Quote(o))
+			}
+		}
+
+		if len(origins) == 1 && origins[0] == "*" {
+			parts = append(parts, f+"=*")
+		} else {
+			parts = append(parts, f+"=("+strings.Join(origins, " ")+")")
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// isHTTPS reports whether req arrived over TLS, trusting the proxy's
+// X-Forwarded-Proto only if told to
+func isHTTPS(req *http.Request, trustForwardedProto bool) bool {
+	if req.TLS != nil {
+		return true
+	}
+
+	if !trustForwardedProto {
+		return false
+	}
+
+	values := req.Header.Values("X-Forwarded-Proto")
+	if len(values) == 0 {
+		return false
+	}
+
+	// proxies append, so only the last entry was set by the trusted proxy,
+	// anything before it may have been sent by the client
+	proto := values[len(values)-1]
+	if idx := strings.LastIndexByte(proto, ','); idx != -1 {
+		proto = proto[idx+1:]
+	}
+
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// applySecurityHeaders sets the Router's security headers and HSTS on w
+func (r *Router) applySecurityHeaders(w http.ResponseWriter, req *http.Request) {
+	sh := r.securityHeaders
+	if sh == nil && !r.enableHSTS {
+		return
+	}
+
+	if sh == nil {
+		sh = &SecurityHeaders{}
+	}
+
+	h := w.Header()
+
+	hsts := sh.HSTS
+	if hsts == nil && r.enableHSTS {
+		hsts = &DefaultHSTS
+	}
+
+	if hsts != nil && isHTTPS(req, sh.TrustForwardedProto) {
+		h.Set("Strict-Transport-Security", hsts.String())
+	}
+
+	set := func(key, value string) {
+		if value != "" {
+			h.Set(key, value)
+		}
+	}
+
+	set("X-Content-Type-Options", sh.ContentTypeOptions)
+	set("X-Frame-Options", sh.FrameOptions)
+	set("Referrer-Policy", sh.ReferrerPolicy)
+	set("Permissions-Policy", sh.permissionsPolicy())
+	set("Cross-Origin-Opener-Policy", sh.CrossOriginOpenerPolicy)
+	set("Cross-Origin-Embedder-Policy", sh.CrossOriginEmbedderPolicy)
+	set("Cross-Origin-Resource-Policy", sh.CrossOriginResourcePolicy)
+}
@@ -0,0 +1,168 @@
+package autohttp
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestHSTSString(t *testing.T) {
+	cases := []struct {
+		Name   string
+		HSTS   HSTS
+		Expect string
+	}{
+		{"max-age", HSTS{MaxAge: time.Hour}, "max-age=3600"},
+		{"default", DefaultHSTS, "max-age=63072000; includeSubDomains"},
+		{"preload", HSTS{MaxAge: 365 * 24 * time.Hour, IncludeSubDomains: true, Preload: true}, "max-age=31536000; includeSubDomains; preload"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			if got := c.HSTS.String(); got != c.Expect {
+				t.Errorf("expected %q got %q", c.Expect, got)
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersRouter(t *testing.T) {
+	assets := fstest.MapFS{
+		"dist/index.html": {Data: []byte("<html></html>")},
+	}
+
+	sh := DefaultSecurityHeaders()
+	sh.TrustForwardedProto = true
+	sh.PermissionsPolicy = map[string][]string{
+		"camera":     {},
+		"fullscreen": {"self", "https://video.example.com"},
+		"autoplay":   {"*"},
+	}
+
+	r, err := NewRouter(
+		lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)),
+		WithEmbeddedAssets(assets, "dist"),
+		WithSecurityHeaders(sh),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/fn", func(ctx context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/raw", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name        string
+		Method      string
+		Path        string
+		TLS         bool
+		Proto       string
+		ExpectHSTS  string
+		ExpectFrame string
+	}{
+		{"handler-plain", http.MethodPost, "/fn", false, "", "", "DENY"},
+		{"handler-tls", http.MethodPost, "/fn", true, "", "max-age=63072000; includeSubDomains", "DENY"},
+		{"raw-override", http.MethodPost, "/raw", false, "https", "max-age=63072000; includeSubDomains", "SAMEORIGIN"},
+		{"forwarded-chain", http.MethodPost, "/raw", false, "http, HTTPS", "max-age=63072000; includeSubDomains", "SAMEORIGIN"},
+		{"forwarded-spoofed", http.MethodPost, "/raw", false, "https, http", "", "SAMEORIGIN"},
+		{"forwarded-http", http.MethodPost, "/raw", false, "http", "", "SAMEORIGIN"},
+		{"asset", http.MethodGet, "/index.html", true, "", "max-age=63072000; includeSubDomains", "DENY"},
+		{"not-found", http.MethodGet, "/missing.js", false, "", "", "DENY"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			req := httptest.NewRequest(c.Method, c.Path, nil)
+			if c.TLS {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if c.Proto != "" {
+				req.Header.Set("X-Forwarded-Proto", c.Proto)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			h := w.Header()
+			if got := h.Get("Strict-Transport-Security"); got != c.ExpectHSTS {
+				t.Errorf("expected HSTS %q got %q", c.ExpectHSTS, got)
+			}
+
+			if got := h.Get("X-Frame-Options"); got != c.ExpectFrame {
+				t.Errorf("expected X-Frame-Options %q got %q", c.ExpectFrame, got)
+			}
+
+			expect := map[string]string{
+				"X-Content-Type-Options":       "nosniff",
+				"Referrer-Policy":              "strict-origin-when-cross-origin",
+				"Permissions-Policy":           `autoplay=*, camera=(), fullscreen=(self "https://video.example.com")`,
+				"Cross-Origin-Opener-Policy":   "same-origin",
+				"Cross-Origin-Resource-Policy": "same-origin",
+				"Cross-Origin-Embedder-Policy": "",
+			}
+			for k, v := range expect {
+				if got := h.Get(k); got != v {
+					t.Errorf("expected %s=%q got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestEnableHSTS(t *testing.T) {
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), EnableHSTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/fn", func(ctx context.Context) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secure := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodPost, "/fn", nil)
+		// without WithSecurityHeaders a proxy is never trusted
+		req.Header.Set("X-Forwarded-Proto", "https")
+		if secure {
+			req.TLS = &tls.ConnectionState{}
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		expect := ""
+		if secure {
+			expect = DefaultHSTS.String()
+		}
+
+		if got := w.Header().Get("Strict-Transport-Security"); got != expect {
+			t.Errorf("tls=%v: expected %q got %q", secure, expect, got)
+		}
+
+		if got := w.Header().Get("X-Content-Type-Options"); got != "" {
+			t.Errorf("expected no other security headers, got nosniff=%q", got)
+		}
+	}
+}
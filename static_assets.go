@@ -0,0 +1,303 @@
+package autohttp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache-Control values for embedded assets. Fingerprinted files never
+// change under the same name, everything else is revalidated by ETag
+const (
+	immutableCacheControl  = "public, max-age=31536000, immutable"
+	revalidateCacheControl = "no-cache"
+	spaFallbackIndex       = "index.html"
+	contentSniffLength     = 512
+)
+
+// precompressedEncodings maps Content-Encoding tokens to the file suffix of
+// a precompressed sibling, in order of preference
+var precompressedEncodings = []struct {
+	encoding string
+	suffix   string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// fingerprintPattern captures the last . or - separated part of a name
+// before its extension, such as 3f2a9c1d in app.3f2a9c1d.js or B1x9kq2Z
+// in index-B1x9kq2Z.css
+var fingerprintPattern = regexp.MustCompile(`[.-]([A-Za-z0-9_]+)\.[A-Za-z0-9]+$`)
+
+// hexHashLengths are the lengths of hex content hashes, as written by
+// webpack and others, truncated or in full
+var hexHashLengths = map[int]bool{8: true, 16: true, 20: true, 32: true, 40: true, 64: true}
+
+// isFingerprinted reports whether name carries a content hash of a fixed
+// length and alphabet: hex from webpack, base32 from esbuild or base64url
+// from Vite and Rollup. Anything else, such as report-2024final.pdf, is
+// revalidated, as caching an unhashed file forever serves stale edits
+func isFingerprinted(name string) bool {
+	m := fingerprintPattern.FindStringSubmatch(path.Base(name))
+	if m == nil {
+		return false
+	}
+
+	hash := m[1]
+	hasDigit := strings.ContainsAny(hash, "0123456789")
+	hasLower := strings.ContainsAny(hash, "abcdefghijklmnopqrstuvwxyz")
+	hasUpper := strings.ContainsAny(hash, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+
+	switch {
+	case strings.Trim(hash, "0123456789abcdef") == "":
+		return hexHashLengths[len(hash)] && hasDigit && hasLower
+	case len(hash) != 8 || !hasDigit || !hasUpper:
+		return false
+	case !hasLower:
+		return strings.Trim(hash, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") == ""
+	default:
+		return true
+	}
+}
+
+// assetFile is what is known about an embedded file, computed at startup
+type assetFile struct {
+	name        string
+	etag        string
+	contentType string
+	modTime     time.Time
+
+	// variants maps a Content-Encoding to its precompressed sibling
+	variants map[string]*assetFile
+}
+
+// embeddedAssets serves an fs.FS, indexed once at startup
+type embeddedAssets struct {
+	staticDir fs.FS
+	files     map[string]*assetFile
+}
+
+func newEmbeddedAssets(assets fs.FS, distDir string) (*embeddedAssets, error) {
+	staticFS, err := fs.Sub(assets, distDir)
+	if err != nil {
+		return nil, err
+	}
+
+	ea := &embeddedAssets{
+		staticDir: staticFS,
+		files:     make(map[string]*assetFile),
+	}
+
+	err = fs.WalkDir(staticFS, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		af, err := indexAsset(staticFS, name)
+		if err != nil {
+			return err
+		}
+
+		ea.files[name] = af
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// attach precompressed siblings to the files they compress, and hide
+	// them from lookup, as they are only valid with a Content-Encoding
+	var siblings []string
+	for name, af := range ea.files {
+		for _, pe := range precompressedEncodings {
+			sibling, ok := ea.files[name+pe.suffix]
+			if !ok {
+				continue
+			}
+
+			if af.variants == nil {
+				af.variants = make(map[string]*assetFile)
+			}
+
+			af.variants[pe.encoding] = sibling
+			siblings = append(siblings, sibling.name)
+		}
+	}
+
+	for _, name := range siblings {
+		delete(ea.files, name)
+	}
+
+	return ea, nil
+}
+
+func indexAsset(fsys fs.FS, name string) (*assetFile, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	sniff := make([]byte, contentSniffLength)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	hash.Write(sniff[:n])
+
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(sniff[:n])
+	}
+
+	return &assetFile{
+		name:        name,
+		etag:        `"` + base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:16]) + `"`,
+		contentType: contentType,
+		modTime:     info.ModTime(),
+	}, nil
+}
+
+// lookup resolves a request path to a file, serving index.html for
+// directories
+func (ea *embeddedAssets) lookup(urlPath string) *assetFile {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		return ea.files[spaFallbackIndex]
+	}
+
+	if af, ok := ea.files[name]; ok {
+		return af
+	}
+
+	return ea.files[path.Join(name, "index.html")]
+}
+
+// ServeHTTP serves embedded files with ETags and cache headers, preferring
+// precompressed siblings the client accepts. Unknown paths fall back to
+// index.html for single page apps, but only when the client asks for HTML
+// and the path has no file extension, so a missing script is a real 404
+func (ea *embeddedAssets) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	af := ea.lookup(req.URL.Path)
+	if af == nil {
+		if !acceptsHTML(req) || path.Ext(req.URL.Path) != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		af = ea.files[spaFallbackIndex]
+		if af == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+
+	h := w.Header()
+	if isFingerprinted(af.name) {
+		h.Set("Cache-Control", immutableCacheControl)
+	} else {
+		h.Set("Cache-Control", revalidateCacheControl)
+	}
+
+	served := af
+	if len(af.variants) > 0 {
+		h.Add("Vary", "Accept-Encoding")
+		if encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"), af.variants); encoding != "" {
+			served = af.variants[encoding]
+			h.Set("Content-Encoding", encoding)
+		}
+	}
+
+	h.Set("Content-Type", af.contentType)
+	h.Set("ETag", served.etag)
+
+	f, err := ea.staticDir.Open(served.name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	http.ServeContent(w, req, af.name, served.modTime, content)
+}
+
+func acceptsHTML(req *http.Request) bool {
+	for _, mr := range parseAccept(req.Header.Values("Accept")) {
+		if mr.q > 0 && (mr.typ == "text" && (mr.subtype == "html" || mr.subtype == "*") || mr.typ == "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the available encoding the client prefers most,
+// breaking ties by precompressedEncodings order
+func negotiateEncoding(acceptEncoding string, available map[string]*assetFile) string {
+	type candidate struct {
+		encoding string
+		q        float64
+		rank     int
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		token := strings.TrimSpace(part)
+		q := 1.0
+		if idx := strings.IndexByte(token, ';'); idx != -1 {
+			params := strings.TrimSpace(token[idx+1:])
+			token = strings.TrimSpace(token[:idx])
+			if strings.HasPrefix(params, "q=") {
+				parsed, err := strconv.ParseFloat(params[2:], 64)
+				if err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		for rank, pe := range precompressedEncodings {
+			if strings.EqualFold(token, pe.encoding) && q > 0 && available[pe.encoding] != nil {
+				candidates = append(candidates, candidate{pe.encoding, q, rank})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].rank < candidates[j].rank
+	})
+
+	return candidates[0].encoding
+}
@@ -0,0 +1,119 @@
+package autohttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedAssets(t *testing.T) {
+	assets := fstest.MapFS{
+		"dist/index.html":                {Data: []byte("<html>app</html>")},
+		"dist/assets/app-B1x9kq2Z.js":    {Data: []byte("console.log(1)")},
+		"dist/assets/app-B1x9kq2Z.js.br": {Data: []byte("brotli")},
+		"dist/assets/app-B1x9kq2Z.js.gz": {Data: []byte("gzip")},
+		"dist/robots.txt":                {Data: []byte("User-agent: *")},
+		"dist/docs/index.html":           {Data: []byte("<html>docs</html>")},
+	}
+
+	r, err := NewRouter(nil, WithEmbeddedAssets(assets, "dist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etag := r.embeddedAssets.files["robots.txt"].etag
+
+	cases := []struct {
+		Name           string
+		Path           string
+		Header         http.Header
+		ExpectStatus   int
+		ExpectBody     string
+		ExpectEncoding string
+		ExpectCache    string
+		ExpectType     string
+	}{
+		{"index", "/", nil, http.StatusOK, "<html>app</html>", "", revalidateCacheControl, "text/html; charset=utf-8"},
+		{"dir-index", "/docs/", nil, http.StatusOK, "<html>docs</html>", "", revalidateCacheControl, "text/html; charset=utf-8"},
+		{"fingerprinted", "/assets/app-B1x9kq2Z.js", nil, http.StatusOK, "console.log(1)", "", immutableCacheControl, "text/javascript; charset=utf-8"},
+		{"brotli", "/assets/app-B1x9kq2Z.js", http.Header{"Accept-Encoding": {"gzip, deflate, br"}}, http.StatusOK, "brotli", "br", immutableCacheControl, "text/javascript; charset=utf-8"},
+		{"gzip-preferred", "/assets/app-B1x9kq2Z.js", http.Header{"Accept-Encoding": {"br;q=0.5, gzip"}}, http.StatusOK, "gzip", "gzip", immutableCacheControl, "text/javascript; charset=utf-8"},
+		{"brotli-refused", "/assets/app-B1x9kq2Z.js", http.Header{"Accept-Encoding": {"br;q=0"}}, http.StatusOK, "console.log(1)", "", immutableCacheControl, "text/javascript; charset=utf-8"},
+		{"spa-fallback", "/settings/profile", http.Header{"Accept": {"text/html,application/xhtml+xml,*/*;q=0.8"}}, http.StatusOK, "<html>app</html>", "", revalidateCacheControl, "text/html; charset=utf-8"},
+		{"missing-asset", "/assets/missing.js", http.Header{"Accept": {"text/html"}}, http.StatusNotFound, "", "", "", ""},
+		{"sibling-hidden", "/assets/app-B1x9kq2Z.js.br", nil, http.StatusNotFound, "", "", "", ""},
+		{"missing-favicon", "/favicon.ico", http.Header{"Accept": {"image/avif,image/webp,*/*"}}, http.StatusNotFound, "", "", "", ""},
+		{"missing-json-client", "/settings/profile", http.Header{"Accept": {"application/json"}}, http.StatusNotFound, "", "", "", ""},
+		{"not-modified", "/robots.txt", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, "", "", revalidateCacheControl, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, c.Path, nil)
+			for k, v := range c.Header {
+				req.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != c.ExpectStatus {
+				t.Fatalf("expected %d got %d", c.ExpectStatus, w.Code)
+			}
+
+			if w.Body.String() != c.ExpectBody {
+				t.Errorf("expected body %q got %q", c.ExpectBody, w.Body.String())
+			}
+
+			if w.Header().Get("Content-Encoding") != c.ExpectEncoding {
+				t.Errorf("expected encoding %q got %q", c.ExpectEncoding, w.Header().Get("Content-Encoding"))
+			}
+
+			if w.Header().Get("Cache-Control") != c.ExpectCache {
+				t.Errorf("expected cache control %q got %q", c.ExpectCache, w.Header().Get("Cache-Control"))
+			}
+
+			if c.ExpectType != "" && w.Header().Get("Content-Type") != c.ExpectType {
+				t.Errorf("expected content type %q got %q", c.ExpectType, w.Header().Get("Content-Type"))
+			}
+
+			if c.ExpectStatus == http.StatusOK && w.Header().Get("ETag") == "" {
+				t.Error("expected an ETag")
+			}
+		})
+	}
+
+	br := r.embeddedAssets.files["assets/app-B1x9kq2Z.js"]
+	if br.etag == br.variants["br"].etag {
+		t.Error("expected each encoding to have its own ETag")
+	}
+}
+
+func TestIsFingerprinted(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Expect bool
+	}{
+		{"assets/index-B1x9kq2Z.js", true},
+		{"app.3f2a9c1d.css", true},
+		{"main.9b0f1e2a4c6d8e0f1a2b.js", true},
+		{"chunk-5XJ3K2QZ.js", true},
+		{"main.js", false},
+		{"components-Button.js", false},
+		{"robots.txt", false},
+		{"report-2024final.pdf", false},
+		{"app.bundle1.js", false},
+		{"app.bundle12.js", false},
+		{"photo-20240101.jpg", false},
+		{"app.3f2a9c1d0.js", false},
+		{"README12.md", false},
+		{"jquery-3.6.0.min.js", false},
+	}
+
+	for _, c := range cases {
+		if got := isFingerprinted(c.Name); got != c.Expect {
+			t.Errorf("%s: expected %t got %t", c.Name, c.Expect, got)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package autohttp
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TextEncoder writes values as text/plain, using encoding.TextMarshaler or
+// fmt.Stringer when a value implements them
+type TextEncoder struct{}
+
+func (te *TextEncoder) ValidateType(fn interface{}) error {
+	return nil
+}
+
+func (te *TextEncoder) MediaType() string {
+	return "text/plain"
+}
+
+func (te *TextEncoder) Encode(value interface{}, hw HeaderWriter) (int, io.Reader, error) {
+	hw("Content-Type", "text/plain; charset=utf-8")
+
+	var text string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		text = string(b)
+	case fmt.Stringer:
+		text = v.String()
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	return http.StatusOK, strings.NewReader(text), nil
+}
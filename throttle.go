@@ -0,0 +1,108 @@
+package autohttp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrThrottleQueueFull is returned with a 503 when a route is at
+	// capacity and its queue has no room
+	ErrThrottleQueueFull = errors.New("server is busy, queue is full")
+	// ErrThrottleTimeout is returned with a 503 when a queued request
+	// waits longer than the Throttler allows
+	ErrThrottleTimeout = errors.New("server is busy, timed out waiting")
+)
+
+// Throttler caps how many requests a route serves at once. Requests over
+// the cap wait in a bounded queue for up to Timeout, and are rejected with
+// a 503 when the queue is full or the wait runs out.
+//
+// Every route given the same Throttler shares its capacity
+type Throttler struct {
+	slots   chan struct{}
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+// NewThrottler allows maxInFlight requests at once with up to maxQueue
+// waiting. A zero timeout waits until the request is cancelled
+func NewThrottler(maxInFlight, maxQueue int, timeout time.Duration) (*Throttler, error) {
+	if maxInFlight <= 0 || maxQueue < 0 {
+		return nil, errors.New("throttler needs a positive in-flight limit and a non-negative queue")
+	}
+
+	return &Throttler{
+		slots:   make(chan struct{}, maxInFlight),
+		queue:   make(chan struct{}, maxQueue),
+		timeout: timeout,
+	}, nil
+}
+
+// WithRouteThrottle applies t to a single route
+func WithRouteThrottle(t *Throttler) RouteOption {
+	return func(rc *routeConfig) error {
+		if t == nil {
+			return errors.New("throttler must not be nil")
+		}
+
+		rc.throttler = t
+		return nil
+	}
+}
+
+// acquire takes an in-flight slot, queueing if needed
+func (t *Throttler) acquire(r *http.Request) error {
+	select {
+	case t.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	select {
+	case t.queue <- struct{}{}:
+	default:
+		return ErrThrottleQueueFull
+	}
+	defer func() { <-t.queue }()
+
+	var timeout <-chan time.Time
+	if t.timeout > 0 {
+		timer := time.NewTimer(t.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrThrottleTimeout
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+func (t *Throttler) release() {
+	<-t.slots
+}
+
+type throttleHandler struct {
+	throttler    *Throttler
+	errorHandler ErrorHandler
+	next         http.Handler
+}
+
+func (th *throttleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := th.throttler.acquire(r)
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(th.throttler.timeout)))
+		th.errorHandler(w, r, ErrorWithCode{Err: err, StatusCode: http.StatusServiceUnavailable})
+		return
+	}
+	defer th.throttler.release()
+
+	th.next.ServeHTTP(w, r)
+}
@@ -0,0 +1,81 @@
+package autohttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestThrottler(t *testing.T) {
+	th, err := NewThrottler(1, 1, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{}, 3)
+	unblock := make(chan struct{})
+
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/slow", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-unblock
+	}), WithRouteThrottle(th))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/slow", nil))
+		return w.Code
+	}
+
+	var (
+		wg    sync.WaitGroup
+		first int
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first = serve()
+	}()
+	<-started
+
+	// one request fits in the queue and times out, the next finds it full
+	queued := make(chan int)
+	go func() { queued <- serve() }()
+
+	time.Sleep(10 * time.Millisecond)
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected full queue to be rejected, got %d", code)
+	}
+
+	if code := <-queued; code != http.StatusServiceUnavailable {
+		t.Errorf("expected queued request to time out, got %d", code)
+	}
+
+	close(unblock)
+	wg.Wait()
+
+	if first != http.StatusOK {
+		t.Errorf("expected first request to succeed, got %d", first)
+	}
+
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("expected capacity to be released, got %d", code)
+	}
+
+	_, err = NewThrottler(0, 1, time.Second)
+	if err == nil {
+		t.Error("expected an invalid throttler to be rejected")
+	}
+}
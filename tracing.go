@@ -0,0 +1,377 @@
+package autohttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fortytw2/lounge"
+)
+
+// TraceID identifies a trace across every service it passes through
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id TraceID) IsZero() bool { return id == TraceID{} }
+
+// SpanID identifies a single span within a trace
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+func (id SpanID) IsZero() bool { return id == SpanID{} }
+
+// TraceFlagSampled marks a trace as recorded by the caller, unsampled
+// spans are propagated but never exported
+const TraceFlagSampled byte = 0x01
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// parseTraceparent parses a W3C traceparent header, such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceparent(h string) (TraceID, SpanID, byte, error) {
+	var (
+		traceID TraceID
+		spanID  SpanID
+	)
+
+	h = strings.TrimSpace(h)
+	// later versions may append fields, which version 00 parsers ignore
+	if len(h) < 55 || (len(h) > 55 && (h[:2] == "00" || h[55] != '-')) {
+		return traceID, spanID, 0, errInvalidTraceparent
+	}
+
+	if h[2] != '-' || h[35] != '-' || h[52] != '-' || h[:2] == "ff" {
+		return traceID, spanID, 0, errInvalidTraceparent
+	}
+
+	// only lower case hex is valid
+	for _, c := range h[:55] {
+		if c != '-' && !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return traceID, spanID, 0, errInvalidTraceparent
+		}
+	}
+
+	flags, err := hex.DecodeString(h[53:55])
+	if err != nil {
+		return traceID, spanID, 0, errInvalidTraceparent
+	}
+
+	_, err = hex.Decode(traceID[:], []byte(h[3:35]))
+	if err != nil || traceID.IsZero() {
+		return traceID, spanID, 0, errInvalidTraceparent
+	}
+
+	_, err = hex.Decode(spanID[:], []byte(h[36:52]))
+	if err != nil || spanID.IsZero() {
+		return traceID, spanID, 0, errInvalidTraceparent
+	}
+
+	return traceID, spanID, flags[0], nil
+}
+
+// A Span times a unit of work within a trace. Every method is safe to call
+// on a nil Span, so code does not need to check whether tracing is enabled
+type Span struct {
+	Name       string
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	TraceFlags byte
+	// TraceState is vendor data propagated unchanged from the caller
+	TraceState string
+
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]string
+	Err        string
+
+	mu     sync.Mutex
+	tracer *tracer
+	ended  bool
+}
+
+// SetAttribute records a key value pair on the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// RecordError marks the span as failed with err
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err.Error()
+}
+
+// End finishes the span and hands it to the exporter if it is sampled.
+// Only the first call has any effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if s.TraceFlags&TraceFlagSampled == 0 {
+		return
+	}
+
+	err := s.tracer.exporter.ExportSpan(s)
+	if err != nil {
+		s.tracer.log.Errorf("could not export span %s: %s", s.SpanID, err)
+	}
+}
+
+// Traceparent formats the span as a W3C traceparent header
+func (s *Span) Traceparent() string {
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-" + hex.EncodeToString([]byte{s.TraceFlags})
+}
+
+func (s *Span) setName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Name = name
+}
+
+// startChild starts a span below s, which is not added to any context
+func (s *Span) startChild(name string) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return s.tracer.newSpan(name, s.TraceID, s.SpanID, s.TraceFlags, s.TraceState)
+}
+
+// finish records err, if any, and ends the span
+func (s *Span) finish(err error) {
+	s.RecordError(err)
+	s.End()
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the current span, or nil if the request is not traced
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+func contextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// StartSpan starts a child of the span in ctx, returning a context holding
+// the new span. If ctx is not traced the returned span is nil
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	s := SpanFromContext(ctx).startChild(name)
+	if s == nil {
+		return ctx, nil
+	}
+
+	return contextWithSpan(ctx, s), s
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers for the
+// span in ctx, continuing the trace in an outgoing request
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return
+	}
+
+	h.Set("Traceparent", s.Traceparent())
+	if s.TraceState != "" {
+		h.Set("Tracestate", s.TraceState)
+	}
+}
+
+// A SpanExporter receives every sampled span once it ends. ExportSpan is
+// called concurrently
+type SpanExporter interface {
+	ExportSpan(s *Span) error
+}
+
+// WithTracing starts a span for every request, continuing any trace given
+// in the traceparent header, and sends finished spans to exporter.
+// Function routes get child spans for decoding, the call and encoding,
+// and the call span is in the context.Context passed to the function
+func WithTracing(exporter SpanExporter) func(r *Router) error {
+	return func(r *Router) error {
+		r.tracer = &tracer{exporter: exporter, log: r.log}
+		return nil
+	}
+}
+
+type tracer struct {
+	exporter SpanExporter
+	log      lounge.Log
+}
+
+func (t *tracer) newSpan(name string, traceID TraceID, parentID SpanID, flags byte, state string) *Span {
+	s := &Span{
+		Name:       name,
+		TraceID:    traceID,
+		ParentID:   parentID,
+		TraceFlags: flags,
+		TraceState: state,
+		StartTime:  time.Now(),
+		tracer:     t,
+	}
+
+	// crypto/rand does not fail on supported platforms
+	rand.Read(s.SpanID[:])
+	return s
+}
+
+// startRequestSpan starts the span for req, continuing the caller's trace
+// if it sent a valid traceparent
+func (t *tracer) startRequestSpan(req *http.Request) (*http.Request, *Span) {
+	traceID, parentID, flags, err := parseTraceparent(req.Header.Get("Traceparent"))
+
+	var state string
+	if err != nil {
+		rand.Read(traceID[:])
+		parentID, flags = SpanID{}, TraceFlagSampled
+	} else {
+		state = strings.Join(req.Header.Values("Tracestate"), ",")
+	}
+
+	s := t.newSpan(req.Method, traceID, parentID, flags, state)
+	s.SetAttribute("http.method", req.Method)
+	s.SetAttribute("http.target", req.URL.Path)
+
+	return req.WithContext(contextWithSpan(req.Context(), s)), s
+}
+
+// endRequestSpan records the outcome of the request and ends its span
+func endRequestSpan(s *Span, status int) {
+	if s == nil {
+		return
+	}
+
+	s.SetAttribute("http.status_code", strconv.Itoa(status))
+	if status >= http.StatusInternalServerError {
+		s.RecordError(errors.New(http.StatusText(status)))
+	}
+
+	s.End()
+}
+
+// spanJSON is the line written for each span by a JSONLinesSpanExporter
+type spanJSON struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_span_id,omitempty"`
+	TraceState string            `json:"trace_state,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Duration   int64             `json:"duration_us"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Err        string            `json:"error,omitempty"`
+}
+
+// JSONLinesSpanExporter writes each span to an io.Writer as a line of JSON
+type JSONLinesSpanExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLinesSpanExporter(w io.Writer) *JSONLinesSpanExporter {
+	return &JSONLinesSpanExporter{w: w}
+}
+
+func (je *JSONLinesSpanExporter) ExportSpan(s *Span) error {
+	s.mu.Lock()
+	sj := spanJSON{
+		TraceID:    s.TraceID.String(),
+		SpanID:     s.SpanID.String(),
+		TraceState: s.TraceState,
+		Name:       s.Name,
+		Start:      s.StartTime,
+		End:        s.EndTime,
+		Duration:   s.EndTime.Sub(s.StartTime).Microseconds(),
+		Attributes: s.Attributes,
+		Err:        s.Err,
+	}
+
+	if !s.ParentID.IsZero() {
+		sj.ParentID = s.ParentID.String()
+	}
+
+	line, err := json.Marshal(sj)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	je.mu.Lock()
+	defer je.mu.Unlock()
+
+	_, err = je.w.Write(append(line, '\n'))
+	return err
+}
+
+// MemorySpanExporter keeps every exported span, for use in tests
+type MemorySpanExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func NewMemorySpanExporter() *MemorySpanExporter {
+	return &MemorySpanExporter{}
+}
+
+func (me *MemorySpanExporter) ExportSpan(s *Span) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.spans = append(me.spans, s)
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended
+func (me *MemorySpanExporter) Spans() []*Span {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	return append([]*Span{}, me.spans...)
+}
+
+// Reset forgets every exported span
+func (me *MemorySpanExporter) Reset() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.spans = nil
+}
@@ -0,0 +1,247 @@
+package autohttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		Name        string
+		Header      string
+		ExpectTrace string
+		ExpectSpan  string
+		ExpectFlags byte
+		ShouldErr   bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 1, false},
+		{"unsampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 0, false},
+		{"future-version", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", 1, false},
+		{"version-00-extra", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "", "", 0, true},
+		{"version-ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", 0, true},
+		{"zero-trace", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", 0, true},
+		{"zero-span", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", "", 0, true},
+		{"upper-case", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", "", 0, true},
+		{"short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", "", "", 0, true},
+		{"empty", "", "", "", 0, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			traceID, spanID, flags, err := parseTraceparent(c.Header)
+			if err != nil && !c.ShouldErr {
+				t.Fatalf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Fatalf("case[%s] did not fail when it should have", c.Name)
+			}
+
+			if c.ShouldErr {
+				return
+			}
+
+			if traceID.String() != c.ExpectTrace || spanID.String() != c.ExpectSpan || flags != c.ExpectFlags {
+				t.Errorf("got %s %s %d", traceID, spanID, flags)
+			}
+		})
+	}
+}
+
+func newTracedRouter(t *testing.T, exporter SpanExporter) *Router {
+	r, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithTracing(exporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(http.MethodPost, "/users/{id}", func(ctx context.Context, in *echoInput) (*echoInput, error) {
+		_, span := StartSpan(ctx, "lookup")
+		span.SetAttribute("user.name", in.Name)
+		span.End()
+
+		return in, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func spansByName(spans []*Span) map[string]*Span {
+	byName := make(map[string]*Span)
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+
+	return byName
+}
+
+func TestTracingRouter(t *testing.T) {
+	exporter := NewMemorySpanExporter()
+	r := newTracedRouter(t, exporter)
+
+	cases := []struct {
+		Name         string
+		Traceparent  string
+		Tracestate   string
+		ExpectSpans  int
+		ExpectTrace  string
+		ExpectParent string
+	}{
+		{"new-trace", "", "", 5, "", ""},
+		{"continued", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=abc", 5, "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"},
+		{"unsampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "", 0, "", ""},
+		{"invalid", "00-nope", "vendor=abc", 5, "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			exporter.Reset()
+
+			req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader(`{"name":"a"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if c.Traceparent != "" {
+				req.Header.Set("Traceparent", c.Traceparent)
+			}
+			if c.Tracestate != "" {
+				req.Header.Set("Tracestate", c.Tracestate)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected 200 got %d", w.Code)
+			}
+
+			spans := exporter.Spans()
+			if len(spans) != c.ExpectSpans {
+				t.Fatalf("expected %d spans got %d", c.ExpectSpans, len(spans))
+			}
+
+			if c.ExpectSpans == 0 {
+				return
+			}
+
+			byName := spansByName(spans)
+			root := byName["POST /users/{id}"]
+			if root == nil {
+				t.Fatalf("expected a request span named after the route, got %v", byName)
+			}
+
+			if c.ExpectTrace != "" && root.TraceID.String() != c.ExpectTrace {
+				t.Errorf("expected trace %s got %s", c.ExpectTrace, root.TraceID)
+			}
+
+			if root.ParentID.String() != c.ExpectParent && !(c.ExpectParent == "" && root.ParentID.IsZero()) {
+				t.Errorf("expected parent %q got %s", c.ExpectParent, root.ParentID)
+			}
+
+			expectState := ""
+			if c.ExpectTrace != "" {
+				expectState = c.Tracestate
+			}
+			if root.TraceState != expectState {
+				t.Errorf("expected tracestate %q got %q", expectState, root.TraceState)
+			}
+
+			if root.Attributes["http.route"] != "/users/{id}" || root.Attributes["http.status_code"] != "200" {
+				t.Errorf("unexpected request attributes %v", root.Attributes)
+			}
+
+			for _, name := range []string{"decode", "call", "encode"} {
+				s := byName[name]
+				if s == nil || s.ParentID != root.SpanID || s.TraceID != root.TraceID {
+					t.Errorf("expected %s to be a child of the request span", name)
+				}
+			}
+
+			lookup := byName["lookup"]
+			if lookup == nil || lookup.ParentID != byName["call"].SpanID || lookup.Attributes["user.name"] != "a" {
+				t.Errorf("expected the function's span to be a child of the call span")
+			}
+
+			// the request span ends last
+			if spans[len(spans)-1] != root {
+				t.Error("expected the request span to be exported last")
+			}
+		})
+	}
+}
+
+func TestTracingPropagation(t *testing.T) {
+	downstreamSpans := NewMemorySpanExporter()
+	downstream := httptest.NewServer(newTracedRouter(t, downstreamSpans))
+	defer downstream.Close()
+
+	upstreamSpans := NewMemorySpanExporter()
+	upstream, err := NewRouter(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), WithTracing(upstreamSpans))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{BaseURL: downstream.URL}
+	err = upstream.Register(http.MethodPost, "/proxy", func(ctx context.Context, in *echoInput) (*echoInput, error) {
+		var out echoInput
+		err := c.Do(ctx, ClientCall{Method: http.MethodPost, Path: "/users/1", Input: in, InputEncoding: ClientJSON, OutputEncoding: ClientJSON}, &out)
+		return &out, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/proxy", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	upstream.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", w.Code, w.Body.String())
+	}
+
+	call := spansByName(upstreamSpans.Spans())["call"]
+	root := spansByName(downstreamSpans.Spans())["POST /users/{id}"]
+	if call == nil || root == nil {
+		t.Fatal("expected spans from both routers")
+	}
+
+	if root.TraceID != call.TraceID || root.ParentID != call.SpanID {
+		t.Errorf("expected the downstream request to continue the upstream call span")
+	}
+}
+
+func TestJSONLinesSpanExporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := newTracedRouter(t, NewJSONLinesSpanExporter(&buf))
+
+	req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines got %d:\n%s", len(lines), buf.String())
+	}
+
+	var last spanJSON
+	err := json.Unmarshal([]byte(lines[4]), &last)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last.Name != "POST /users/{id}" || last.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || last.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected span line %s", lines[4])
+	}
+
+	if last.Attributes["http.status_code"] != "200" || last.End.Before(last.Start) {
+		t.Errorf("unexpected span line %s", lines[4])
+	}
+}
@@ -0,0 +1,554 @@
+package autohttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// typeScriptHashPrefix starts the header line holding the hash of a
+// generated TypeScript client
+const typeScriptHashPrefix = "// autohttp-hash: sha256:"
+
+// ErrStaleGeneratedFile is returned by CheckTypeScriptClient when a
+// generated file no longer matches the Router
+var ErrStaleGeneratedFile = errors.New("generated file is stale, regenerate it")
+
+// GenerateTypeScriptClient emits a TypeScript module with an interface for
+// every type used by a function route and a Client class with one typed
+// fetch method per route. Interfaces follow the JSON encoding: json tags
+// name properties, omitempty fields are optional and pointers may be null.
+//
+// The second line of the output records a hash of the rest, which
+// CheckTypeScriptClient compares so CI can catch stale files
+func (r *Router) GenerateTypeScriptClient() ([]byte, error) {
+	g := newTSGenerator()
+
+	var methods bytes.Buffer
+	for _, route := range r.introspectRoutes() {
+		err := g.writeMethod(&methods, route)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", route.method, route.pattern, err)
+		}
+	}
+
+	var body bytes.Buffer
+	body.WriteString(tsRuntime)
+
+	names := make([]string, 0, len(g.decls))
+	for name := range g.decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if g.decls[name] != "" {
+			body.WriteString("\n" + g.decls[name])
+		}
+	}
+
+	body.WriteString(tsClientHeader)
+	body.Write(methods.Bytes())
+	body.WriteString("}\n")
+
+	sum := sha256.Sum256(body.Bytes())
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by autohttp; DO NOT EDIT.\n")
+	out.WriteString(typeScriptHashPrefix + hex.EncodeToString(sum[:]) + "\n")
+	out.Write(body.Bytes())
+
+	return out.Bytes(), nil
+}
+
+// CheckTypeScriptClient returns ErrStaleGeneratedFile if existing, a file
+// written from GenerateTypeScriptClient, differs from what the Router
+// generates now or has been edited by hand
+func (r *Router) CheckTypeScriptClient(existing []byte) error {
+	fresh, err := r.GenerateTypeScriptClient()
+	if err != nil {
+		return err
+	}
+
+	recorded := typeScriptHash(existing)
+	if recorded == "" || recorded != typeScriptHash(fresh) {
+		return ErrStaleGeneratedFile
+	}
+
+	// catch hand edits that left the recorded hash alone
+	parts := bytes.SplitN(existing, []byte("\n"), 3)
+	sum := sha256.Sum256(parts[len(parts)-1])
+	if hex.EncodeToString(sum[:]) != recorded {
+		return ErrStaleGeneratedFile
+	}
+
+	return nil
+}
+
+// typeScriptHash returns the hash recorded in a generated file's header
+func typeScriptHash(src []byte) string {
+	for _, line := range strings.SplitN(string(src), "\n", 3) {
+		if strings.HasPrefix(line, typeScriptHashPrefix) {
+			return strings.TrimPrefix(line, typeScriptHashPrefix)
+		}
+	}
+
+	return ""
+}
+
+const tsRuntime = `
+export interface FieldError {
+  field: string;
+  message: string;
+}
+
+export class AutohttpError extends Error {
+  constructor(
+    public readonly status: number,
+    message: string,
+    public readonly fields?: FieldError[],
+  ) {
+    super(message);
+  }
+}
+
+export interface ClientOptions {
+  baseURL?: string;
+  headers?: Record<string, string>;
+  fetch?: typeof fetch;
+}
+
+type QueryValue = string | number | boolean | null | undefined | Array<string | number | boolean>;
+
+function toSearchParams(values: Record<string, unknown>): URLSearchParams {
+  const params = new URLSearchParams();
+  for (const [key, value] of Object.entries(values)) {
+    const list = Array.isArray(value) ? value : [value as QueryValue];
+    for (const v of list) {
+      if (v !== null && v !== undefined) {
+        params.append(key, String(v));
+      }
+    }
+  }
+  return params;
+}
+
+function toFormData(values: Record<string, unknown>): FormData {
+  const form = new FormData();
+  for (const [key, value] of Object.entries(values)) {
+    const list = Array.isArray(value) ? value : [value];
+    for (const v of list) {
+      if (v instanceof Blob) {
+        form.append(key, v);
+      } else if (v !== null && v !== undefined) {
+        form.append(key, String(v));
+      }
+    }
+  }
+  return form;
+}
+`
+
+const tsClientHeader = `
+export class Client {
+  constructor(private readonly options: ClientOptions = {}) {}
+
+  private async _call(
+    method: string,
+    path: string,
+    init: {
+      body?: BodyInit;
+      contentType?: string;
+      query?: Record<string, unknown>;
+      headers?: Record<string, string>;
+      accept?: string;
+    },
+  ): Promise<Response> {
+    let url = (this.options.baseURL ?? "").replace(/\/$/, "") + path;
+    if (init.query) {
+      const qs = toSearchParams(init.query).toString();
+      if (qs) {
+        url += "?" + qs;
+      }
+    }
+
+    const headers: Record<string, string> = { ...this.options.headers, ...init.headers };
+    if (init.contentType) {
+      headers["Content-Type"] = init.contentType;
+    }
+    if (init.accept) {
+      headers["Accept"] = init.accept;
+    }
+
+    const res = await (this.options.fetch ?? fetch)(url, { method, headers, body: init.body });
+    if (!res.ok) {
+      const text = await res.text();
+      let message = res.statusText;
+      let fields: FieldError[] | undefined;
+      try {
+        const body = JSON.parse(text);
+        message = body.error ?? body.detail ?? body.title ?? message;
+        fields = body.errors;
+      } catch {
+        // not a JSON error body
+      }
+      throw new AutohttpError(res.status, message, fields);
+    }
+
+    return res;
+  }
+`
+
+type tsGenerator struct {
+	names map[reflect.Type]string
+	taken map[string]reflect.Type
+
+	// decls holds the declaration of every named type, keyed by name
+	decls map[string]string
+}
+
+// newTSGenerator reserves the names declared by the runtime, mapping
+// FieldError onto the Go type it mirrors
+func newTSGenerator() *tsGenerator {
+	g := &tsGenerator{
+		names: make(map[reflect.Type]string),
+		taken: make(map[string]reflect.Type),
+		decls: make(map[string]string),
+	}
+
+	reserved := reflect.TypeOf(tsGenerator{})
+	for _, name := range []string{"AutohttpError", "ClientOptions", "Client", "QueryValue"} {
+		g.taken[name] = reserved
+	}
+
+	fieldErrorType := reflect.TypeOf(FieldError{})
+	g.names[fieldErrorType] = "FieldError"
+	g.taken["FieldError"] = fieldErrorType
+	g.decls["FieldError"] = ""
+
+	return g
+}
+
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func tsPropertyName(name string) string {
+	if tsIdentifier.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// typeName picks a unique TypeScript name for a named Go type
+func (g *tsGenerator) typeName(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	base := upperFirst(goIdentifier(t.Name()))
+	name := base
+	if other, ok := g.taken[name]; ok && other != t {
+		pkg := t.PkgPath()
+		if idx := strings.LastIndexByte(pkg, '/'); idx != -1 {
+			pkg = pkg[idx+1:]
+		}
+		name = upperFirst(goIdentifier(pkg)) + base
+
+		for n := 2; g.taken[name] != nil; n++ {
+			name = upperFirst(goIdentifier(pkg)) + base + strconv.Itoa(n)
+		}
+	}
+
+	g.names[t] = name
+	g.taken[name] = t
+	return name
+}
+
+// tsRootType spells a whole request or response body, where a pointer only
+// reflects how the value is passed rather than nullability
+func (g *tsGenerator) tsRootType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return g.tsType(t)
+}
+
+// tsType spells t as it appears once encoded as JSON
+func (g *tsGenerator) tsType(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return g.tsType(t.Elem()) + " | null"
+	}
+
+	switch {
+	case t == timeType:
+		return "string"
+	case t == jsonRawMessageType || t == emptyInterfaceType:
+		return "unknown"
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return "string"
+	}
+
+	var expr string
+	switch t.Kind() {
+	case reflect.Bool:
+		expr = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		expr = "number"
+	case reflect.String:
+		expr = "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// base64 encoded
+			expr = "string"
+		} else {
+			expr = tsArray(g.tsType(t.Elem()))
+		}
+	case reflect.Map:
+		expr = "Record<string, " + g.tsType(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.tsObject(t, "")
+		}
+		expr = ""
+	default:
+		expr = "unknown"
+	}
+
+	if t.Name() == "" || t.PkgPath() == "" {
+		return expr
+	}
+
+	name := g.typeName(t)
+	if _, ok := g.decls[name]; !ok {
+		// reserve the name first so recursive types terminate
+		g.decls[name] = ""
+		if t.Kind() == reflect.Struct {
+			g.decls[name] = "export interface " + name + " " + g.tsObject(t, "") + "\n"
+		} else {
+			g.decls[name] = "export type " + name + " = " + expr + ";\n"
+		}
+	}
+
+	return name
+}
+
+func tsArray(elem string) string {
+	if strings.ContainsAny(elem, " |") {
+		return "Array<" + elem + ">"
+	}
+	return elem + "[]"
+}
+
+// tsObject spells the properties of struct t using its json tags
+func (g *tsGenerator) tsObject(t reflect.Type, indent string) string {
+	sg := &schemaGenerator{tag: "json"}
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, p := range sg.schemaProperties(t) {
+		opt := ""
+		if p.omitEmpty {
+			opt = "?"
+		}
+		fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, tsPropertyName(p.name), opt, g.tsType(p.field.Type))
+	}
+	b.WriteString(indent + "}")
+
+	return b.String()
+}
+
+// tsValuesObject spells the keys read by a query or form decoder
+func (g *tsGenerator) tsValuesObject(t reflect.Type, tag string) (string, bool, error) {
+	vs, err := compileValuesStruct(t, tag)
+	if err != nil {
+		return "", false, err
+	}
+
+	st := t
+	for st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, f := range vs.fields {
+		opt := "?"
+		if strings.Contains(","+st.FieldByIndex(f.index).Tag.Get("validate")+",", ",required,") {
+			opt = ""
+		}
+
+		ft := f.typ
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		fmt.Fprintf(&b, "    %s%s: %s;\n", tsPropertyName(f.key), opt, g.tsType(ft))
+	}
+
+	for _, f := range vs.files {
+		typ := "Blob"
+		if f.typ == formFileSliceType {
+			typ = "Blob[]"
+		}
+		fmt.Fprintf(&b, "    %s?: %s;\n", tsPropertyName(f.key), typ)
+	}
+	b.WriteString("  }")
+
+	return b.String(), len(vs.files) > 0, nil
+}
+
+// tsInput describes how a generated method sends its input to a decoder
+type tsInput struct {
+	typ  string
+	init []string
+}
+
+func (g *tsGenerator) input(d Decoder, t reflect.Type) (*tsInput, error) {
+	switch dec := d.(type) {
+	case *JSONDecoder:
+		return &tsInput{typ: g.tsRootType(t), init: []string{`body: JSON.stringify(input)`, `contentType: "application/json"`}}, nil
+	case *QueryDecoder:
+		obj, _, err := g.tsValuesObject(t, "query")
+		if err != nil {
+			return nil, err
+		}
+		return &tsInput{typ: obj, init: []string{"query: input"}}, nil
+	case *FormDecoder:
+		obj, files, err := g.tsValuesObject(t, "form")
+		if err != nil {
+			return nil, err
+		}
+		if files {
+			return &tsInput{typ: obj, init: []string{"body: toFormData(input)"}}, nil
+		}
+		return &tsInput{typ: obj, init: []string{"body: toSearchParams(input)", `contentType: "application/x-www-form-urlencoded"`}}, nil
+	case *ContentTypeDecoder:
+		for _, mt := range dec.mediaTypes() {
+			if _, ok := dec.decoders[mt].(*JSONDecoder); ok {
+				return g.input(dec.decoders[mt], t)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("decoder %T is not supported by TypeScript clients", d)
+}
+
+// outputReader returns the expression that reads the response body of e
+func outputReader(e Encoder) (string, string, error) {
+	switch enc := e.(type) {
+	case *JSONEncoder:
+		return "application/json", "res.json()", nil
+	case *TextEncoder:
+		return enc.MediaType(), "res.text()", nil
+	case *CSVEncoder:
+		return enc.MediaType(), "res.text()", nil
+	case *NegotiatingEncoder:
+		for _, sub := range enc.encoders {
+			if _, ok := sub.(*JSONEncoder); ok {
+				return outputReader(sub)
+			}
+		}
+		for _, sub := range enc.encoders {
+			if accept, read, err := outputReader(sub); err == nil {
+				return accept, read, nil
+			}
+		}
+	}
+
+	return "", "", fmt.Errorf("encoder %T is not supported by TypeScript clients", e)
+}
+
+func (g *tsGenerator) writeMethod(w *bytes.Buffer, route introspectedRoute) error {
+	tokens, err := parsePattern(route.pattern)
+	if err != nil {
+		return err
+	}
+
+	var (
+		params []string
+		path   []string
+		init   []string
+	)
+	for _, tok := range tokens {
+		switch {
+		case tok.param == "":
+			if tok.static != "" {
+				path = append(path, strconv.Quote(tok.static))
+			}
+		case tok.catchAll:
+			name := goParamName(tok.param)
+			params = append(params, name+": string")
+			path = append(path, name+`.split("/").map(encodeURIComponent).join("/")`)
+		default:
+			name := goParamName(tok.param)
+			params = append(params, name+": string")
+			path = append(path, "encodeURIComponent("+name+")")
+		}
+	}
+
+	fnType := reflect.TypeOf(route.handler.fn)
+	for i := 0; i < fnType.NumIn(); i++ {
+		if isHeaderType(fnType.In(i)) {
+			params = append(params, "headers: Record<string, string>")
+			init = append(init, "headers")
+		}
+	}
+
+	if in := route.decodeType(); in != nil {
+		ti, err := g.input(route.handler.decoder, in)
+		if err != nil {
+			return err
+		}
+		params = append(params, "input: "+ti.typ)
+		init = append(init, ti.init...)
+	} else if _, ok := route.handler.decoder.(*JSONDecoder); ok {
+		init = append(init, `contentType: "application/json"`)
+	}
+
+	returns, read := "void", ""
+	if out := route.response().body; out != nil {
+		accept, reader, err := outputReader(route.handler.encoder)
+		if err != nil {
+			return err
+		}
+
+		returns, read = g.tsRootType(out), "await "+reader
+		if reader == "res.text()" {
+			returns = "string"
+		}
+
+		// a Response envelope may leave out the body at runtime
+		if out == emptyInterfaceType {
+			read = "res.status === 204 ? undefined : " + read
+		}
+		init = append(init, "accept: "+strconv.Quote(accept))
+	}
+
+	name := lowerFirst(goIdentifier(route.name))
+	fmt.Fprintf(w, "\n  /** %s %s */\n", route.method, route.pattern)
+	fmt.Fprintf(w, "  async %s(%s): Promise<%s> {\n", name, strings.Join(params, ", "), returns)
+
+	initExpr := "{}"
+	if len(init) > 0 {
+		initExpr = "{ " + strings.Join(init, ", ") + " }"
+	}
+
+	call := fmt.Sprintf("this._call(%q, %s, %s)", route.method, strings.Join(path, " + "), initExpr)
+	if read == "" {
+		fmt.Fprintf(w, "    await %s;\n", call)
+	} else {
+		fmt.Fprintf(w, "    const res = await %s;\n", call)
+		fmt.Fprintf(w, "    return (%s) as %s;\n", read, returns)
+	}
+	w.WriteString("  }\n")
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package autohttp
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tsTestRole string
+
+type tsTestUser struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name,omitempty"`
+	Role      tsTestRole        `json:"role"`
+	Manager   *tsTestUser       `json:"manager"`
+	Tags      []string          `json:"tags"`
+	Labels    map[string]int    `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	Extra     *string           `json:"extra-info"`
+	Skipped   string            `json:"-"`
+	Errors    FieldErrors       `json:"errors,omitempty"`
+	Meta      map[string]string `json:"meta"`
+}
+
+func TestGenerateTypeScriptClient(t *testing.T) {
+	r := newClientTestRouter(t)
+	err := r.Register(http.MethodPost, "/ts/users", func(ctx context.Context, h Header, u *tsTestUser) ([]*tsTestUser, error) {
+		return nil, nil
+	}, WithRouteName("listTSUsers"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := r.GenerateTypeScriptClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{
+		"export type TsTestRole = string;",
+		"export interface TsTestUser {\n  id: string;\n  name?: string;\n  role: TsTestRole;\n  manager: TsTestUser | null;\n  tags: string[];\n  labels?: Record<string, number>;\n  created_at: string;\n  \"extra-info\": string | null;\n  errors?: FieldErrors;\n  meta: Record<string, string>;\n}",
+		"export type FieldErrors = FieldError[];",
+		"async listTSUsers(headers: Record<string, string>, input: TsTestUser): Promise<Array<TsTestUser | null>> {",
+		"async getUser(pId: string): Promise<ClientTestUser> {",
+		`this._call("GET", "/users/" + encodeURIComponent(pId), { accept: "application/json" })`,
+		"async search(input: {\n    q?: string;\n    tag?: string[];\n    page?: number;\n  }): Promise<string[]> {",
+		"async deleteFile(pPath: string): Promise<void> {",
+		"async envelope(): Promise<unknown> {",
+		"return (res.status === 204 ? undefined : await res.json()) as unknown;",
+		"return (await res.json()) as ClientTestUser;",
+	} {
+		if !bytes.Contains(src, []byte(expect)) {
+			t.Errorf("expected generated client to contain %q\n%s", expect, src)
+		}
+	}
+
+	if bytes.Count(src, []byte("export interface FieldError ")) != 1 {
+		t.Error("FieldError declared more than once")
+	}
+
+	again, err := r.GenerateTypeScriptClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(src, again) {
+		t.Error("expected generation to be stable")
+	}
+
+	err = r.CheckTypeScriptClient(src)
+	if err != nil {
+		t.Errorf("expected fresh file to pass, got %s", err)
+	}
+
+	edited := bytes.Replace(src, []byte("tags: string[]"), []byte("tags: number[]"), 1)
+	if r.CheckTypeScriptClient(edited) != ErrStaleGeneratedFile {
+		t.Error("expected a hand edit to be caught")
+	}
+
+	err = r.Register(http.MethodPost, "/ts/new", func(ctx context.Context, u *tsTestUser) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.CheckTypeScriptClient(src) != ErrStaleGeneratedFile {
+		t.Error("expected a new route to make the file stale")
+	}
+
+	if !strings.HasPrefix(string(src), "// Code generated by autohttp; DO NOT EDIT.\n"+typeScriptHashPrefix) {
+		t.Error("expected generated header")
+	}
+}
@@ -0,0 +1,345 @@
+package autohttp
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// valuesField maps a single key of url.Values onto a (possibly nested) struct field
+type valuesField struct {
+	key   string
+	index []int
+	typ   reflect.Type
+}
+
+// valuesStruct is the compiled mapping from url.Values keys to the
+// fields of a struct, built once per type and tag name
+type valuesStruct struct {
+	fields []valuesField
+	files  []valuesField
+	keys   map[string]bool
+}
+
+type valuesStructKey struct {
+	t   reflect.Type
+	tag string
+}
+
+var valuesStructCache sync.Map
+
+// compileValuesStruct validates that every field of t can be filled from
+// url.Values using the given struct tag, and caches the result
+func compileValuesStruct(t reflect.Type, tag string) (*valuesStruct, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+
+	cacheKey := valuesStructKey{t: t, tag: tag}
+	if vs, ok := valuesStructCache.Load(cacheKey); ok {
+		return vs.(*valuesStruct), nil
+	}
+
+	vs := &valuesStruct{keys: make(map[string]bool)}
+	err := vs.addFields(t, tag, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	valuesStructCache.Store(cacheKey, vs)
+	return vs, nil
+}
+
+func (vs *valuesStruct) addFields(t reflect.Type, tag string, prefix string, index []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			// unexported
+			continue
+		}
+
+		name := sf.Tag.Get(tag)
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+
+		if isNestedValuesStruct(sf.Type) {
+			nestedPrefix := prefix
+			if !sf.Anonymous || name != "" {
+				if name == "" {
+					name = sf.Name
+				}
+				nestedPrefix = prefix + name + "."
+			}
+
+			err := vs.addFields(sf.Type, tag, nestedPrefix, fieldIndex)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		key := prefix + name
+		if vs.keys[key] {
+			return fmt.Errorf("field %s: key is used more than once", key)
+		}
+		vs.keys[key] = true
+
+		if sf.Type == formFileType || sf.Type == formFileSliceType {
+			vs.files = append(vs.files, valuesField{key: key, index: fieldIndex, typ: sf.Type})
+			continue
+		}
+
+		err := checkValuesType(sf.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", key, err)
+		}
+
+		vs.fields = append(vs.fields, valuesField{key: key, index: fieldIndex, typ: sf.Type})
+	}
+
+	return nil
+}
+
+func isNestedValuesStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !isValuesScalar(t)
+}
+
+func isValuesScalar(t reflect.Type) bool {
+	if t == timeType || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+func checkValuesType(t reflect.Type) error {
+	switch {
+	case isValuesScalar(t):
+		return nil
+	case t.Kind() == reflect.Ptr && isValuesScalar(t.Elem()):
+		return nil
+	case t.Kind() == reflect.Slice && isValuesScalar(t.Elem()):
+		return nil
+	}
+
+	return fmt.Errorf("unsupported type %s", t)
+}
+
+// decode fills target, which must be an addressable struct, from values
+func (vs *valuesStruct) decode(target reflect.Value, values url.Values, disallowUnknown bool) error {
+	var fieldErrs FieldErrors
+
+	if disallowUnknown {
+		for k := range values {
+			if !vs.keys[k] {
+				fieldErrs = append(fieldErrs, FieldError{Field: k, Message: "unknown field"})
+			}
+		}
+	}
+
+	for _, f := range vs.fields {
+		vals, ok := values[f.key]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+
+		err := setFromStrings(target.FieldByIndex(f.index), vals)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: f.key, Message: err.Error()})
+		}
+	}
+
+	if len(fieldErrs) > 0 {
+		return fieldErrs
+	}
+
+	return nil
+}
+
+func setFromStrings(v reflect.Value, vals []string) error {
+	t := v.Type()
+
+	switch {
+	case isValuesScalar(t):
+		return setScalar(v, vals[0])
+	case t.Kind() == reflect.Ptr:
+		nv := reflect.New(t.Elem())
+		err := setScalar(nv.Elem(), vals[0])
+		if err != nil {
+			return err
+		}
+
+		v.Set(nv)
+		return nil
+	case t.Kind() == reflect.Slice:
+		sv := reflect.MakeSlice(t, len(vals), len(vals))
+		for i, s := range vals {
+			err := setScalar(sv.Index(i), s)
+			if err != nil {
+				return err
+			}
+		}
+
+		v.Set(sv)
+		return nil
+	}
+
+	return fmt.Errorf("unsupported type %s", t)
+}
+
+func setScalar(v reflect.Value, s string) error {
+	if v.Type() == timeType {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			ts, err := time.Parse(layout, s)
+			if err == nil {
+				v.Set(reflect.ValueOf(ts))
+				return nil
+			}
+		}
+
+		return fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", s)
+	}
+
+	if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", s)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// encode is the inverse of decode, flattening src into url.Values. Nil
+// pointers are left out and file fields are ignored
+func (vs *valuesStruct) encode(src reflect.Value) (url.Values, error) {
+	for src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return url.Values{}, nil
+		}
+		src = src.Elem()
+	}
+
+	values := make(url.Values)
+	for _, f := range vs.fields {
+		v := src.FieldByIndex(f.index)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+
+		if v.Kind() == reflect.Slice && !isValuesScalar(v.Type()) {
+			for i := 0; i < v.Len(); i++ {
+				s, err := formatScalar(v.Index(i))
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", f.key, err)
+				}
+				values.Add(f.key, s)
+			}
+			continue
+		}
+
+		s, err := formatScalar(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.key, err)
+		}
+		values.Set(f.key, s)
+	}
+
+	return values, nil
+}
+
+func formatScalar(v reflect.Value) (string, error) {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+
+	if v.CanAddr() {
+		if tm, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			b, err := tm.MarshalText()
+			return string(b), err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
@@ -0,0 +1,458 @@
+package autohttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// A Validator is an input type that checks itself once its tag rules have
+// passed. Returning FieldErrors reports problems with individual fields.
+//
+// Decoded arguments are validated before the function is called, using the
+// rules in their `validate` struct tags:
+//
+//	required      the field must not be its zero value (or nil)
+//	omitempty     skip the remaining rules when the field is empty
+//	min=N, max=N  bounds on a number, or on the length of a string, slice or map
+//	len=N         exact length of a string, slice or map
+//	email         a valid email address
+//	url           an absolute URL
+//	oneof=a b c   one of the space separated values
+//
+// Nested structs, pointers to structs and slices of structs are validated
+// recursively, down to the last level of a self-referencing type such as a
+// tree, and any failures are returned with a 422 status code
+type Validator interface {
+	Validate() error
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// structValidator holds the rules compiled from the `validate` tags of a
+// struct type, built once when the Handler is created
+type structValidator struct {
+	fields       []fieldValidator
+	selfValidate bool
+}
+
+type fieldValidator struct {
+	name      string
+	index     []int
+	required  bool
+	omitEmpty bool
+	rules     []fieldRule
+	nested    *structValidator
+	elems     *structValidator
+}
+
+type fieldRule func(v reflect.Value) string
+
+var (
+	validatorCache sync.Map
+
+	// errNoValidation marks a type with nothing to validate
+	errNoValidation = errors.New("no validation rules")
+)
+
+// compileValidator builds the validator for t, returning nil if t has no
+// rules and does not implement Validator
+func compileValidator(t reflect.Type) (*structValidator, error) {
+	sv, err := compileStructValidator(t, map[reflect.Type]*structValidator{})
+	if err == errNoValidation {
+		return nil, nil
+	}
+
+	return sv, err
+}
+
+// compileStructValidator compiles t, where inProgress holds the validators
+// of the types being compiled further up. A recursive type points back to
+// its own validator, so every level of it is validated
+func compileStructValidator(t reflect.Type, inProgress map[reflect.Type]*structValidator) (*structValidator, error) {
+	selfValidate := t.Implements(validatorType) || reflect.PtrTo(t).Implements(validatorType)
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		if selfValidate {
+			return &structValidator{selfValidate: true}, nil
+		}
+		return nil, errNoValidation
+	}
+
+	if sv, ok := inProgress[t]; ok {
+		return sv, nil
+	}
+
+	if cached, ok := validatorCache.Load(t); ok {
+		if cached == nil {
+			return nil, errNoValidation
+		}
+		return cached.(*structValidator), nil
+	}
+
+	// checked up front, so a recursive type without rules is not compiled
+	// into a validator that walks it for nothing
+	if !hasValidation(t, map[reflect.Type]bool{}) {
+		validatorCache.Store(t, nil)
+		return nil, errNoValidation
+	}
+
+	sv := &structValidator{selfValidate: selfValidate}
+	inProgress[t] = sv
+	defer delete(inProgress, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		fv := fieldValidator{name: validationFieldName(sf), index: sf.Index}
+
+		tag := sf.Tag.Get("validate")
+		if tag != "" && tag != "-" {
+			err := fv.compileRules(sf.Type, tag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+			}
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		var err error
+		switch ft.Kind() {
+		case reflect.Struct:
+			fv.nested, err = compileStructValidator(sf.Type, inProgress)
+		case reflect.Slice, reflect.Array:
+			fv.elems, err = compileStructValidator(ft.Elem(), inProgress)
+		default:
+			err = errNoValidation
+		}
+
+		if err != nil && err != errNoValidation {
+			return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+		}
+
+		if fv.required || len(fv.rules) > 0 || fv.nested != nil || fv.elems != nil {
+			sv.fields = append(sv.fields, fv)
+		}
+	}
+
+	if len(sv.fields) == 0 && !sv.selfValidate {
+		validatorCache.Store(t, nil)
+		return nil, errNoValidation
+	}
+
+	validatorCache.Store(t, sv)
+	return sv, nil
+}
+
+// hasValidation reports whether t, or any type reachable through its
+// fields, has validate tags or implements Validator
+func hasValidation(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t.Implements(validatorType) || reflect.PtrTo(t).Implements(validatorType) {
+		return true
+	}
+
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+		if t.Implements(validatorType) || reflect.PtrTo(t).Implements(validatorType) {
+			return true
+		}
+	}
+
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+			return true
+		}
+
+		if hasValidation(sf.Type, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validationFieldName names a field the way clients see it
+func validationFieldName(sf reflect.StructField) string {
+	for _, tagName := range []string{"json", "form", "query"} {
+		name := strings.Split(sf.Tag.Get(tagName), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return sf.Name
+}
+
+func (fv *fieldValidator) compileRules(t reflect.Type, tag string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg := rule, ""
+		if idx := strings.IndexByte(rule, '='); idx != -1 {
+			name, arg = rule[:idx], rule[idx+1:]
+		}
+
+		switch name {
+		case "required":
+			fv.required = true
+		case "omitempty":
+			fv.omitEmpty = true
+		case "min", "max", "len":
+			r, err := boundRule(t, name, arg)
+			if err != nil {
+				return err
+			}
+			fv.rules = append(fv.rules, r)
+		case "email":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("email rule requires a string, not %s", t)
+			}
+			fv.rules = append(fv.rules, func(v reflect.Value) string {
+				addr, err := mail.ParseAddress(v.String())
+				if err != nil || addr.Address != v.String() {
+					return "must be a valid email address"
+				}
+				return ""
+			})
+		case "url":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("url rule requires a string, not %s", t)
+			}
+			fv.rules = append(fv.rules, func(v reflect.Value) string {
+				u, err := url.Parse(v.String())
+				if err != nil || u.Scheme == "" || u.Host == "" {
+					return "must be an absolute URL"
+				}
+				return ""
+			})
+		case "oneof":
+			r, err := oneOfRule(t, arg)
+			if err != nil {
+				return err
+			}
+			fv.rules = append(fv.rules, r)
+		default:
+			return fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+
+	return nil
+}
+
+func boundRule(t reflect.Type, name, arg string) (fieldRule, error) {
+	n, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s rule needs a number, got %q", name, arg)
+	}
+
+	var measure func(v reflect.Value) float64
+	var unit string
+	switch t.Kind() {
+	case reflect.String:
+		measure = func(v reflect.Value) float64 { return float64(utf8.RuneCountInString(v.String())) }
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		measure = func(v reflect.Value) float64 { return float64(v.Len()) }
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		measure = func(v reflect.Value) float64 { return float64(v.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		measure = func(v reflect.Value) float64 { return float64(v.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		measure = func(v reflect.Value) float64 { return v.Float() }
+	default:
+		return nil, fmt.Errorf("%s rule cannot be used with %s", name, t)
+	}
+
+	if name == "len" && unit == "" {
+		return nil, fmt.Errorf("len rule cannot be used with %s", t)
+	}
+
+	limit := strconv.FormatFloat(n, 'f', -1, 64)
+	return func(v reflect.Value) string {
+		m := measure(v)
+		switch {
+		case name == "min" && m < n:
+			if unit == "" {
+				return "must be at least " + limit
+			}
+			return "must have at least " + limit + unit
+		case name == "max" && m > n:
+			if unit == "" {
+				return "must be at most " + limit
+			}
+			return "must have at most " + limit + unit
+		case name == "len" && m != n:
+			return "must have exactly " + limit + unit
+		}
+		return ""
+	}, nil
+}
+
+func oneOfRule(t reflect.Type, arg string) (fieldRule, error) {
+	options := strings.Fields(arg)
+	if len(options) == 0 {
+		return nil, errors.New("oneof rule needs at least one value")
+	}
+
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return nil, fmt.Errorf("oneof rule cannot be used with %s", t)
+	}
+
+	allowed := make(map[string]bool, len(options))
+	for _, o := range options {
+		allowed[o] = true
+	}
+
+	msg := "must be one of " + strings.Join(options, ", ")
+	return func(v reflect.Value) string {
+		if !allowed[fmt.Sprint(v.Interface())] {
+			return msg
+		}
+		return ""
+	}, nil
+}
+
+// validate checks v against the compiled rules, returning FieldErrors
+// wrapped in a 422 ErrorWithCode
+func (sv *structValidator) validate(v reflect.Value) error {
+	var errs FieldErrors
+	err := sv.check(v, "", &errs)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return ErrorWithCode{Err: errs, StatusCode: http.StatusUnprocessableEntity}
+	}
+
+	return nil
+}
+
+func (sv *structValidator) check(v reflect.Value, path string, errs *FieldErrors) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	before := len(*errs)
+	for _, fv := range sv.fields {
+		err := fv.check(v.FieldByIndex(fv.index), path+fv.name, errs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// only ask the type to validate itself when its tags pass
+	if !sv.selfValidate || len(*errs) > before || !v.CanInterface() {
+		return nil
+	}
+
+	var validator Validator
+	if v.CanAddr() && v.Addr().Type().Implements(validatorType) {
+		validator = v.Addr().Interface().(Validator)
+	} else if v.Type().Implements(validatorType) {
+		validator = v.Interface().(Validator)
+	}
+
+	if validator == nil {
+		return nil
+	}
+
+	err := validator.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var fieldErrs FieldErrors
+	if errors.As(err, &fieldErrs) {
+		for _, fe := range fieldErrs {
+			fe.Field = path + fe.Field
+			*errs = append(*errs, fe)
+		}
+		return nil
+	}
+
+	if hasStatusCode(err) {
+		return err
+	}
+
+	return ErrorWithCode{Err: err, StatusCode: http.StatusUnprocessableEntity}
+}
+
+func (fv fieldValidator) check(v reflect.Value, path string, errs *FieldErrors) error {
+	empty := v.IsZero()
+	if fv.required && empty {
+		*errs = append(*errs, FieldError{Field: path, Message: "is required"})
+		return nil
+	}
+
+	if fv.omitEmpty && empty {
+		return nil
+	}
+
+	elem := v
+	for elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return nil
+		}
+		elem = elem.Elem()
+	}
+
+	for _, rule := range fv.rules {
+		if msg := rule(elem); msg != "" {
+			*errs = append(*errs, FieldError{Field: path, Message: msg})
+			return nil
+		}
+	}
+
+	if fv.nested != nil {
+		return fv.nested.check(elem, path+".", errs)
+	}
+
+	if fv.elems != nil {
+		for i := 0; i < elem.Len(); i++ {
+			err := fv.elems.check(elem.Index(i), fmt.Sprintf("%s[%d].", path, i), errs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package autohttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fortytw2/lounge"
+)
+
+type validatedAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type validatedItem struct {
+	SKU string `json:"sku" validate:"len=4"`
+}
+
+type validatedSignup struct {
+	Name     string             `json:"name" validate:"required,min=1,max=8"`
+	Email    string             `json:"email" validate:"required,email"`
+	Plan     string             `json:"plan" validate:"oneof=free pro"`
+	Age      *int               `json:"age" validate:"omitempty,min=18"`
+	Website  string             `json:"website" validate:"omitempty,url"`
+	Tags     []string           `json:"tags" validate:"max=2"`
+	Address  *validatedAddress  `json:"address"`
+	Items    []validatedItem    `json:"items"`
+	Password string             `json:"password"`
+	Confirm  string             `json:"confirm"`
+	Extra    map[string]float64 `json:"extra"`
+}
+
+func (vs validatedSignup) Validate() error {
+	if vs.Password != vs.Confirm {
+		return FieldErrors{{Field: "confirm", Message: "must match password"}}
+	}
+
+	return nil
+}
+
+type conflictingSignup struct {
+	Name string `json:"name"`
+}
+
+func (cs *conflictingSignup) Validate() error {
+	if cs.Name == "taken" {
+		return ErrorWithCode{Err: errors.New("name is taken"), StatusCode: http.StatusConflict}
+	}
+
+	return nil
+}
+
+func TestValidatorCompile(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name      string
+		Fn        interface{}
+		ShouldErr bool
+	}{
+		{"valid", func(ctx context.Context, in validatedSignup) {}, false},
+		{"no-rules", func(ctx context.Context, in struct{ X int }) {}, false},
+		{"unknown-rule", func(in struct {
+			X string `validate:"shiny"`
+		}) {
+		}, true},
+		{"min-on-bool", func(in struct {
+			X bool `validate:"min=1"`
+		}) {
+		}, true},
+		{"email-on-int", func(in struct {
+			X int `validate:"email"`
+		}) {
+		}, true},
+		{"bad-bound", func(in struct {
+			X int `validate:"max=lots"`
+		}) {
+		}, true},
+		{"nested-invalid", func(in struct {
+			X struct {
+				Y string `validate:"len=x"`
+			}
+		}) {
+		}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			_, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NewJSONDecoder(), NoOpEncoder{}, DefaultErrorHandler, c.Fn)
+			if err != nil && !c.ShouldErr {
+				t.Errorf("case[%s] failed unexpectedly: %s", c.Name, err)
+			}
+
+			if err == nil && c.ShouldErr {
+				t.Errorf("case[%s] did not fail when it should have", c.Name)
+			}
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	var called bool
+	fn := func(ctx context.Context, in validatedSignup) {
+		called = true
+	}
+
+	cases := []struct {
+		Name         string
+		Body         string
+		ExpectStatus int
+		ExpectErrors FieldErrors
+	}{
+		{
+			"valid",
+			`{"name":"bob","email":"bob@example.com","plan":"pro","age":20,"website":"https://example.com","address":{"city":"Paris"},"items":[{"sku":"abcd"}]}`,
+			http.StatusNoContent,
+			nil,
+		},
+		{
+			"missing-required",
+			`{"plan":"free"}`,
+			http.StatusUnprocessableEntity,
+			FieldErrors{{Field: "name", Message: "is required"}, {Field: "email", Message: "is required"}},
+		},
+		{
+			"rules",
+			`{"name":"bobbybobbybob","email":"nope","plan":"gold","age":12,"website":"example","tags":["a","b","c"]}`,
+			http.StatusUnprocessableEntity,
+			FieldErrors{
+				{Field: "name", Message: "must have at most 8 characters"},
+				{Field: "email", Message: "must be a valid email address"},
+				{Field: "plan", Message: "must be one of free, pro"},
+				{Field: "age", Message: "must be at least 18"},
+				{Field: "website", Message: "must be an absolute URL"},
+				{Field: "tags", Message: "must have at most 2 items"},
+			},
+		},
+		{
+			"nested",
+			`{"name":"bob","email":"bob@example.com","plan":"free","address":{},"items":[{"sku":"abcd"},{"sku":"ab"}]}`,
+			http.StatusUnprocessableEntity,
+			FieldErrors{{Field: "address.city", Message: "is required"}, {Field: "items[1].sku", Message: "must have exactly 4 characters"}},
+		},
+		{
+			"validate-method",
+			`{"name":"bob","email":"bob@example.com","plan":"free","password":"a","confirm":"b"}`,
+			http.StatusUnprocessableEntity,
+			FieldErrors{{Field: "confirm", Message: "must match password"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			called = false
+
+			var gotErr error
+			errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+				gotErr = err
+				DefaultErrorHandler(w, r, err)
+			}
+
+			ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NewJSONDecoder(), NoOpEncoder{}, errorHandler, fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.Body))
+			r.Header.Set("Content-Type", "application/json")
+			ar.ServeHTTP(w, r)
+
+			if w.Code != c.ExpectStatus {
+				t.Fatalf("expected %d got %d: %s", c.ExpectStatus, w.Code, w.Body.String())
+			}
+
+			if called != (c.ExpectErrors == nil) {
+				t.Errorf("unexpected call state %v", called)
+			}
+
+			if c.ExpectErrors != nil {
+				var fieldErrs FieldErrors
+				if !errors.As(gotErr, &fieldErrs) {
+					t.Fatalf("expected FieldErrors, got %v", gotErr)
+				}
+
+				if !reflect.DeepEqual(fieldErrs, c.ExpectErrors) {
+					t.Errorf("expected %v got %v", c.ExpectErrors, fieldErrs)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateMethodStatusCode(t *testing.T) {
+	ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NewJSONDecoder(), NoOpEncoder{}, DefaultErrorHandler, func(in *conflictingSignup) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"taken"}`))
+	r.Header.Set("Content-Type", "application/json")
+	ar.ServeHTTP(w, r)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected %d got %d", http.StatusConflict, w.Code)
+	}
+}
+
+type validatedNode struct {
+	Name     string          `json:"name" validate:"required"`
+	Children []validatedNode `json:"children"`
+	Next     *validatedNode  `json:"next"`
+}
+
+type unvalidatedNode struct {
+	Name     string
+	Children []unvalidatedNode
+}
+
+func TestRecursiveValidation(t *testing.T) {
+	sv, err := compileValidator(reflect.TypeOf(unvalidatedNode{}))
+	if err != nil || sv != nil {
+		t.Errorf("expected no validator for a recursive type without rules, got %v %v", sv, err)
+	}
+
+	cases := []struct {
+		Name         string
+		Body         string
+		ExpectErrors FieldErrors
+	}{
+		{"valid", `{"name":"a","children":[{"name":"b","children":[{"name":"c"}]}],"next":{"name":"d"}}`, nil},
+		{
+			"deep",
+			`{"name":"a","children":[{"name":"b","children":[{}]}],"next":{"name":"d","next":{}}}`,
+			FieldErrors{{Field: "children[0].children[0].name", Message: "is required"}, {Field: "next.next.name", Message: "is required"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var gotErr error
+			errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+				gotErr = err
+				DefaultErrorHandler(w, r, err)
+			}
+
+			ar, err := NewHandler(lounge.NewDefaultLog(lounge.WithOutput(os.Stderr)), NewJSONDecoder(), NoOpEncoder{}, errorHandler, func(in validatedNode) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.Body))
+			r.Header.Set("Content-Type", "application/json")
+			ar.ServeHTTP(httptest.NewRecorder(), r)
+
+			var fieldErrs FieldErrors
+			errors.As(gotErr, &fieldErrs)
+			if !reflect.DeepEqual(fieldErrs, c.ExpectErrors) {
+				t.Errorf("expected %v got %v", c.ExpectErrors, fieldErrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package autohttp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// XMLEncoder encodes values as XML, with slices wrapped in an <items>
+// element so the document has a single root
+type XMLEncoder struct{}
+
+func (xe *XMLEncoder) ValidateType(fn interface{}) error {
+	rt := encodableReturnType(fn)
+	if rt == nil {
+		return nil
+	}
+
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch rt.Kind() {
+	case reflect.Map, reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("xml encoder cannot encode %s", rt)
+	}
+
+	return nil
+}
+
+func (xe *XMLEncoder) MediaType() string {
+	return "application/xml"
+}
+
+func (xe *XMLEncoder) Encode(value interface{}, hw HeaderWriter) (int, io.Reader, error) {
+	hw("Content-Type", "application/xml; charset=utf-8")
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	err := encodeXMLDocument(xml.NewEncoder(&b), value)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, &b, nil
+}
+
+// xmlListElement wraps slices, which would otherwise be written as one
+// root element per item
+var xmlListElement = xml.StartElement{Name: xml.Name{Local: "items"}}
+
+func encodeXMLDocument(enc *xml.Encoder, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	isList := rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array
+	if !isList || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return enc.Encode(value)
+	}
+
+	err := enc.EncodeToken(xmlListElement)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		err := enc.Encode(rv.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = enc.EncodeToken(xmlListElement.End())
+	if err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}